@@ -0,0 +1,209 @@
+// admin looks into the replicas and steers them.
+//
+//	go run . status
+//	go run . -token <token> snapshot :50052
+//	go run . step-down
+//	go run . drain :50051
+//	go run . resume :50051
+//	go run . verify
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	proto "Replication/grpc"
+	"Replication/money"
+	"Replication/security"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var (
+	servers    = flag.String("servers", ":50051,:50052,:50053", "Comma-separated server addresses")
+	caFile     = flag.String("ca", "", "CA that signed the server certificates, turns on TLS")
+	serverName = flag.String("server-name", "localhost", "Name in the server certificates")
+	bearer     = flag.String("token", "", "Admin token from tokengen, if the servers require one")
+	asJSON     = flag.Bool("json", false, "Print the status as JSON")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: admin [flags] status [server...] | snapshot <server> | step-down [server] | drain <server> | resume <server> | verify [server...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dialOpt, err := security.TLSFiles{CA: *caFile, ServerName: *serverName}.DialOption()
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+	dial := func(addr string) proto.AuctionAdminClient {
+		conn, err := grpc.Dial(addr, dialOpt, grpc.WithPerRPCCredentials(security.NewBearerToken(*bearer)))
+		if err != nil {
+			log.Fatalf("Failed to connect to %s: %v", addr, err)
+		}
+		return proto.NewAuctionAdminClient(conn)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch {
+	case args[0] == "status":
+		addrs := args[1:]
+		if len(addrs) == 0 {
+			addrs = strings.Split(*servers, ",")
+		}
+		failed := false
+		for _, addr := range addrs {
+			st, err := dial(addr).Status(ctx, &proto.Empty{})
+			if err != nil {
+				fmt.Printf("%s: %s\n", addr, status.Convert(err).Message())
+				failed = true
+				continue
+			}
+			printStatus(st)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	case args[0] == "verify":
+		addrs := args[1:]
+		if len(addrs) == 0 {
+			addrs = strings.Split(*servers, ",")
+		}
+		failed := false
+		for _, addr := range addrs {
+			report, err := dial(addr).VerifyLedger(ctx, &proto.Empty{})
+			if err != nil {
+				fmt.Printf("%s: %s\n", addr, status.Convert(err).Message())
+				failed = true
+				continue
+			}
+			printReport(addr, report)
+			if report.MismatchIndex != 0 {
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	case args[0] == "step-down" && len(args) == 1:
+		addr, err := findLeader(ctx, dial)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ack, err := dial(addr).StepDown(ctx, &proto.Empty{})
+		check(err)
+		fmt.Printf("%s %s\n", addr, ack.Ack)
+	case len(args) != 2:
+		flag.Usage()
+		os.Exit(2)
+	case args[0] == "snapshot":
+		info, err := dial(args[1]).Snapshot(ctx, &proto.Empty{})
+		check(err)
+		fmt.Printf("%s: snapshot at index %d (term %d), %d entries compacted\n", args[1], info.Index, info.Term, info.Compacted)
+	case args[0] == "step-down":
+		ack, err := dial(args[1]).StepDown(ctx, &proto.Empty{})
+		check(err)
+		fmt.Printf("%s %s\n", args[1], ack.Ack)
+	case args[0] == "drain", args[0] == "resume":
+		ack, err := dial(args[1]).Drain(ctx, &proto.DrainRequest{Resume: args[0] == "resume"})
+		check(err)
+		fmt.Printf("%s %s\n", args[1], ack.Ack)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func check(err error) {
+	if err != nil {
+		log.Fatal(status.Convert(err).Message())
+	}
+}
+
+// findLeader asks the servers in turn for their status until one leads.
+func findLeader(ctx context.Context, dial func(string) proto.AuctionAdminClient) (string, error) {
+	for _, addr := range strings.Split(*servers, ",") {
+		st, err := dial(addr).Status(ctx, &proto.Empty{})
+		if err == nil && st.Role == "leader" {
+			return addr, nil
+		}
+	}
+	return "", fmt.Errorf("no server leads right now")
+}
+
+func printStatus(st *proto.NodeStatus) {
+	if *asJSON {
+		fmt.Println(protojson.Format(st))
+		return
+	}
+	fmt.Printf("%s: %s in term %d", st.Id, st.Role, st.Term)
+	if st.Leader != "" && st.Leader != st.Id {
+		fmt.Printf(", leader %s", st.Leader)
+	}
+	switch {
+	case st.Draining:
+		fmt.Print(", draining")
+	case st.Recovering:
+		fmt.Print(", recovering")
+	case !st.Serving:
+		fmt.Print(", not serving")
+	}
+	fmt.Println()
+	fmt.Printf("  log: last %d, committed %d, applied %d, snapshot %d; lamport clock %d\n",
+		st.LastLogIndex, st.CommitIndex, st.AppliedIndex, st.SnapshotIndex, st.LamportTime)
+	for _, p := range st.Peers {
+		reach := "unreachable"
+		if p.Reachable {
+			reach = "reachable"
+		}
+		fmt.Printf("  peer %s: %s, connection %s", p.Id, reach, p.Connection)
+		if st.Role == "leader" {
+			fmt.Printf(", match %d, next %d", p.MatchIndex, p.NextIndex)
+		}
+		fmt.Println()
+	}
+	for _, a := range st.Auctions {
+		state := "open"
+		if a.Over {
+			state = "over"
+		} else if a.Deadline != 0 {
+			state = "open until " + time.Unix(a.Deadline, 0).Format(time.TimeOnly)
+		}
+		fmt.Printf("  auction %s: %s, highest bid %s", a.Auction, state, money.Format(a.HighestBid, a.Currency))
+		if a.HighestBidder != "" {
+			fmt.Printf(" by %s", a.HighestBidder)
+		}
+		fmt.Println()
+	}
+}
+
+func printReport(addr string, r *proto.LedgerReport) {
+	head := r.HeadHash
+	if len(head) > 12 {
+		head = head[:12]
+	}
+	fmt.Printf("%s: entries %d to %d, head %s", addr, r.FirstIndex, r.LastIndex, head)
+	switch {
+	case r.MismatchIndex == 0:
+		fmt.Println(", the chain is intact")
+	case r.Peer != "":
+		fmt.Printf("\n  entry %d differs from %s: %s\n", r.MismatchIndex, r.Peer, r.Reason)
+	default:
+		fmt.Printf("\n  entry %d breaks the chain: %s\n", r.MismatchIndex, r.Reason)
+	}
+}
@@ -0,0 +1,150 @@
+// auctioneer creates and closes auctions.
+//
+//	go run . -token <token> create spring 600
+//	go run . -token <token> -currency EUR create autumn
+//	go run . -token <token> close spring
+//	go run . -token <token> result spring
+//	go run . -token <token> -events outbid,winner webhook add https://example.com/hook <secret>
+//	go run . -token <token> webhook list
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	proto "Replication/grpc"
+	"Replication/security"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	servers    = flag.String("servers", ":50051,:50052,:50053", "Comma-separated server addresses")
+	caFile     = flag.String("ca", "", "CA that signed the server certificates, turns on TLS")
+	serverName = flag.String("server-name", "localhost", "Name in the server certificates")
+	bearer     = flag.String("token", "", "Auctioneer token from tokengen, if the servers require one")
+	events     = flag.String("events", "", "Comma-separated events a new webhook gets: outbid, closed, winner. All if empty")
+	auction    = flag.String("auction", "", "Auction whose events a new webhook gets, all auctions' if empty")
+	currency   = flag.String("currency", "", "ISO 4217 code a new auction takes bids in, the servers' default (DKK) if empty")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: auctioneer [flags] create <auction> [seconds] | close <auction> | result <auction> | webhook add <url> <secret> | webhook remove <url> | webhook list")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dialOpt, err := security.TLSFiles{CA: *caFile, ServerName: *serverName}.DialOption()
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+
+	var lastErr error
+	for _, server := range strings.Split(*servers, ",") {
+		conn, err := grpc.Dial(server, dialOpt, grpc.WithPerRPCCredentials(security.NewBearerToken(*bearer)))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		lastErr = run(proto.NewAuctionServerClient(conn), args)
+		conn.Close()
+		if lastErr == nil {
+			return
+		}
+		if status.Code(lastErr) != codes.Unavailable {
+			log.Fatal(status.Convert(lastErr).Message())
+		}
+		log.Printf("%s: %v", server, lastErr)
+	}
+	log.Fatalf("No server could handle the request: %v", lastErr)
+}
+
+func run(client proto.AuctionServerClient, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch args[0] {
+	case "create":
+		var seconds int64
+		if len(args) > 2 {
+			var err error
+			seconds, err = strconv.ParseInt(args[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid duration %q", args[2])
+			}
+		}
+		if _, err := client.CreateAuction(ctx, &proto.AuctionSpec{Auction: args[1], DurationSeconds: seconds, Currency: *currency}); err != nil {
+			return err
+		}
+		fmt.Printf("Auction %s created\n", args[1])
+	case "close":
+		if _, err := client.CloseAuction(ctx, &proto.AuctionRef{Auction: args[1]}); err != nil {
+			return err
+		}
+		fmt.Printf("Auction %s closed\n", args[1])
+	case "result":
+		outcome, err := client.Result(ctx, &proto.AuctionRef{Auction: args[1]})
+		if err != nil {
+			return err
+		}
+		fmt.Println(outcome.Result)
+	case "webhook":
+		return webhook(ctx, client, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+func webhook(ctx context.Context, client proto.AuctionServerClient, args []string) error {
+	switch {
+	case args[0] == "add" && len(args) == 3:
+		hook := &proto.Webhook{Url: args[1], Secret: args[2], Auction: *auction}
+		if *events != "" {
+			hook.Events = strings.Split(*events, ",")
+		}
+		if _, err := client.AddWebhook(ctx, hook); err != nil {
+			return err
+		}
+		fmt.Printf("Webhook %s added\n", args[1])
+	case args[0] == "remove" && len(args) == 2:
+		if _, err := client.RemoveWebhook(ctx, &proto.Webhook{Url: args[1]}); err != nil {
+			return err
+		}
+		fmt.Printf("Webhook %s removed\n", args[1])
+	case args[0] == "list":
+		list, err := client.ListWebhooks(ctx, &proto.Empty{})
+		if err != nil {
+			return err
+		}
+		for _, hook := range list.Webhooks {
+			events, auction := "all events", "all auctions"
+			if len(hook.Events) > 0 {
+				events = strings.Join(hook.Events, ", ")
+			}
+			if hook.Auction != "" {
+				auction = hook.Auction
+			}
+			fmt.Printf("%s: %s of %s\n", hook.Url, events, auction)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
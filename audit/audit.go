@@ -0,0 +1,166 @@
+// audit exports the audit trail of an auction and checks exported trails.
+//
+//	go run . -token <token> export spring > spring.csv
+//	go run . -token <token> -format jsonl export spring > spring.jsonl
+//	go run . -token <token> verify spring.csv
+//	go run . -offline verify spring.csv
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	proto "Replication/grpc"
+	"Replication/ledger"
+	"Replication/security"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	servers    = flag.String("servers", ":50051,:50052,:50053", "Comma-separated server addresses")
+	caFile     = flag.String("ca", "", "CA that signed the server certificates, turns on TLS")
+	serverName = flag.String("server-name", "localhost", "Name in the server certificates")
+	bearer     = flag.String("token", "", "Auctioneer or admin token from tokengen, if the servers require one")
+	format     = flag.String("format", "csv", "Export format: csv or jsonl")
+	offline    = flag.Bool("offline", false, "Only check that the chain holds together, without comparing it to the servers' trail")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: audit [flags] export <auction> | verify <file>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "export":
+		records, err := export(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := ledger.Verify(records); err != nil {
+			log.Fatalf("The servers sent a broken chain: %v", err)
+		}
+		switch *format {
+		case "csv":
+			err = ledger.WriteCSV(os.Stdout, records)
+		case "jsonl":
+			err = ledger.WriteJSONLines(os.Stdout, records)
+		default:
+			log.Fatalf("Unknown format %q, want csv or jsonl", *format)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(records) > 0 {
+			log.Printf("%d records, last hash %s", len(records), records[len(records)-1].Hash)
+		}
+	case "verify":
+		f, err := os.Open(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		records, err := ledger.Read(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", args[1], err)
+		}
+		if err := ledger.Verify(records); err != nil {
+			fmt.Printf("%s: %v\n", args[1], err)
+			os.Exit(1)
+		}
+		if *offline {
+			fmt.Printf("%s: %d records, the chain holds together but was not compared with the servers\n", args[1], len(records))
+			return
+		}
+		if len(records) == 0 {
+			fmt.Printf("%s: no records\n", args[1])
+			return
+		}
+		live, err := export(records[0].Auction)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := ledger.Anchor(records, live); err != nil {
+			fmt.Printf("%s: %v\n", args[1], err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: %d records, the chain is intact and matches the servers\n", args[1], len(records))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// export asks every server for the trail and keeps the longest, as a
+// server may be behind the others. The trails have to agree as far as they
+// go, or one of the servers is wrong and it cannot tell which.
+func export(auction string) ([]ledger.Record, error) {
+	dialOpt, err := security.TLSFiles{CA: *caFile, ServerName: *serverName}.DialOption()
+	if err != nil {
+		return nil, fmt.Errorf("set up TLS: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var best []ledger.Record
+	bestAddr := ""
+	var lastErr error
+	answered := false
+	for _, addr := range strings.Split(*servers, ",") {
+		conn, err := grpc.Dial(addr, dialOpt, grpc.WithPerRPCCredentials(security.NewBearerToken(*bearer)))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		records, err := fetch(ctx, proto.NewAuctionServerClient(conn), auction)
+		conn.Close()
+		if err != nil {
+			log.Printf("%s: %s", addr, status.Convert(err).Message())
+			lastErr = err
+			continue
+		}
+		answered = true
+		if i := ledger.Diverge(records, best); i >= 0 {
+			return nil, fmt.Errorf("%s and %s disagree from record %d (index %d) on", bestAddr, addr, i+1, records[i].Index)
+		}
+		if len(records) > len(best) {
+			best, bestAddr = records, addr
+		}
+	}
+	if !answered {
+		return nil, fmt.Errorf("no server sent the trail: %s", status.Convert(lastErr).Message())
+	}
+	return best, nil
+}
+
+func fetch(ctx context.Context, client proto.AuctionServerClient, auction string) ([]ledger.Record, error) {
+	stream, err := client.ExportAudit(ctx, &proto.AuctionRef{Auction: auction})
+	if err != nil {
+		return nil, err
+	}
+	var records []ledger.Record
+	for {
+		rec, err := stream.Recv()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, ledger.FromProto(rec))
+	}
+}
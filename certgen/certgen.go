@@ -0,0 +1,121 @@
+// certgen makes a CA and certificates for a local development cluster.
+//
+//	go run . -out ../certs -nodes server1,server2,server3
+//
+// Each node certificate can be used both to serve and as a client certificate,
+// so the replicas can use it for mutual TLS between each other.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	out      = flag.String("out", "../certs", "Directory to write the certificates to")
+	nodes    = flag.String("nodes", "server1,server2,server3", "Comma-separated names of the nodes to make certificates for")
+	hosts    = flag.String("hosts", "localhost,127.0.0.1,::1", "Comma-separated host names and IPs every node certificate is valid for")
+	validFor = flag.Duration("valid", 365*24*time.Hour, "How long the certificates are valid")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0700); err != nil {
+		log.Fatalf("Failed to create %s: %v", *out, err)
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalf("Failed to generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          serial(),
+		Subject:               pkix.Name{CommonName: "Auction development CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(*validFor),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		log.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		log.Fatalf("Failed to parse CA certificate: %v", err)
+	}
+	write("ca", caDER, caKey)
+
+	for _, node := range strings.Split(*nodes, ",") {
+		node = strings.TrimSpace(node)
+		if node == "" {
+			continue
+		}
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			log.Fatalf("Failed to generate key for %s: %v", node, err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: serial(),
+			Subject:      pkix.Name{CommonName: node},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(*validFor),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			DNSNames:     []string{node},
+		}
+		for _, host := range strings.Split(*hosts, ",") {
+			if ip := net.ParseIP(host); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else if host != "" {
+				template.DNSNames = append(template.DNSNames, host)
+			}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			log.Fatalf("Failed to create certificate for %s: %v", node, err)
+		}
+		write(node, der, key)
+	}
+
+	log.Printf("Certificates written to %s", *out)
+}
+
+// write stores the certificate as <name>.pem and its key as <name>-key.pem.
+func write(name string, der []byte, key *ecdsa.PrivateKey) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		log.Fatalf("Failed to encode key for %s: %v", name, err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err := os.WriteFile(filepath.Join(*out, name+".pem"), certPEM, 0644); err != nil {
+		log.Fatalf("Failed to write certificate for %s: %v", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(*out, name+"-key.pem"), keyPEM, 0600); err != nil {
+		log.Fatalf("Failed to write key for %s: %v", name, err)
+	}
+}
+
+func serial() *big.Int {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		log.Fatalf("Failed to generate serial number: %v", err)
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+// checker tells whether recorded auction histories are linearizable, i.e.
+// whether the replicated auction answered like a single one would have.
+//
+//	go run . history-1.jsonl history-2.jsonl
+//
+// Histories from several clients are checked together, as one history.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"Replication/history"
+)
+
+var timeout = flag.Duration("timeout", 0, "Give up on an auction after this long, 0 to never give up")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: checker <history.jsonl>...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var events []history.Event
+	var offset int64
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		loaded, err := history.Load(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+
+		// every recorder numbers its operations from 1
+		var highest int64
+		for _, e := range loaded {
+			highest = max(highest, e.ID)
+			e.ID += offset
+			events = append(events, e)
+		}
+		offset += highest
+	}
+
+	ops, err := history.Operations(events)
+	if err != nil {
+		log.Fatal(err)
+	}
+	result := history.CheckTimeout(history.AuctionModel, ops, *timeout)
+
+	var auctions []string
+	for auction := range result.Parts {
+		auctions = append(auctions, auction)
+	}
+	sort.Strings(auctions)
+	for _, auction := range auctions {
+		verdict := "linearizable"
+		if !result.Parts[auction] {
+			verdict = "NOT linearizable"
+		}
+		fmt.Printf("%s: %s\n", auction, verdict)
+	}
+	for _, auction := range result.Undecided {
+		fmt.Printf("%s: undecided after %v\n", auction, *timeout)
+	}
+	fmt.Printf("%d operations checked\n", len(ops))
+	for _, ok := range result.Parts {
+		if !ok {
+			os.Exit(1)
+		}
+	}
+	if len(result.Undecided) > 0 {
+		os.Exit(3)
+	}
+}
@@ -3,146 +3,213 @@ package main
 import (
 	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
+	"Replication/frontend"
 	proto "Replication/grpc"
-
+	"Replication/logging"
+	"Replication/money"
+	"Replication/security"
+	"Replication/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	caFile     = flag.String("ca", "", "CA that signed the server certificates, turns on TLS")
+	serverName = flag.String("server-name", "localhost", "Name in the server certificates")
+	bearer     = flag.String("token", "", "Bearer token to send, if the servers require one and you are not registering")
+	auction    = flag.String("auction", "", "Auction to bid in, the servers' default auction if empty")
+
+	logFile   = flag.String("log-file", "", "File to append the log to, - for standard error, no log if empty")
+	logFormat = flag.String("log-format", "text", "Log format, text or json")
+	logLevel  = flag.String("log-level", "info", "Least level to log: debug, info, warn or error")
+
+	traceExporter = flag.String("trace", "", "Where to send traces: stdout or otlp. Off if empty")
+	otlpEndpoint  = flag.String("otlp-endpoint", "localhost:4317", "OTLP gRPC endpoint to send traces to with -trace otlp")
 )
 
+var tracer = tracing.Tracer("Replication/client")
+
 var bidder string
+var token string
+var currency string // of the auction, learned from the servers before the first bid
 
 func main() {
+	flag.Parse()
+
 	// do it for the log
-	file, err := os.OpenFile("../auction_log.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	logger, closeLog, err := logging.Config{File: *logFile, Format: *logFormat, Level: *logLevel}.Logger()
 	if err != nil {
-		log.Fatalf("failed to open log file: %v", err)
+		log.Fatalf("Failed to set up the log: %v", err)
 	}
-	defer file.Close()
+	defer closeLog()
+	slog.SetDefault(logger)
 
-	log.SetOutput(file)
+	stopTracing, err := tracing.Config{Exporter: *traceExporter, Endpoint: *otlpEndpoint, Service: "auction-client"}.Setup()
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer stopTracing(context.Background())
+
+	dialOpt, err := security.TLSFiles{CA: *caFile, ServerName: *serverName}.DialOption()
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
 
 	// List of server addresses
 	servers := []string{":50051", ":50052", ":50053"}
-	var clients []proto.AuctionServerClient
 
 	// Establish connections to all servers
-	for _, server := range servers {
-		conn, err := grpc.Dial(server, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		if err != nil {
-			log.Printf("Failed to connect to server %s: %v", server, err)
-			continue
-		}
-		clients = append(clients, proto.NewAuctionServerClient(conn))
-	}
-
-	if len(clients) == 0 {
-		log.Fatal("No servers available to connect.")
+	auctionFrontend, err := frontend.Dial(servers, *bearer, dialOpt, tracing.DialOption(), grpc.WithChainUnaryInterceptor(logging.UnaryClientInterceptor()))
+	if err != nil {
+		log.Fatalf("No servers available to connect: %v", err)
 	}
+	defer auctionFrontend.Close()
 
 	fmt.Println("Connected to servers. Bidding started!")
-	log.Println("Client connected to servers. Bidding started!")
+	slog.Info("connected to servers", "servers", servers)
 	input := bufio.NewScanner(os.Stdin)
 	fmt.Println("Enter your username:")
 	input.Scan()
-	bidder = input.Text()
+	bidder = strings.TrimSpace(input.Text())
+
+	token, err = register(auctionFrontend, bidder)
+	if status.Code(err) == codes.AlreadyExists {
+		fmt.Printf("%s is already registered. Enter the token you got for it:\n", bidder)
+		input.Scan()
+		token = strings.TrimSpace(input.Text())
+		if err := login(auctionFrontend, bidder, token); err != nil {
+			fmt.Printf("Failed to log in as %s: %s\n", bidder, status.Convert(err).Message())
+			os.Exit(1)
+		}
+		slog.Info("logged in", "bidder", bidder)
+	} else if err != nil {
+		log.Fatalf("Failed to register %s: %v", bidder, err)
+	} else {
+		slog.Info("registered", "bidder", bidder)
+		fmt.Printf("Registered as %s. Your token is %s, use it to bid as %s again later\n", bidder, token, bidder)
+	}
 
 	// Main loop
 	for {
 		fmt.Println("Please write bid [amount] to bid that amount or result")
-		input.Scan()
+		if !input.Scan() {
+			return
+		}
 		command := strings.TrimSpace(input.Text())
 		parts := strings.Split(command, " ")
 
 		if parts[0] == "bid" && len(parts) == 2 {
-			amount, err := strconv.Atoi(parts[1])
+			if currency == "" {
+				outcome, err := getResults(auctionFrontend)
+				if err != nil {
+					fmt.Println("Error fetching the auction's currency:", err)
+					continue
+				}
+				currency = outcome.Currency
+			}
+			amount, err := money.Parse(parts[1], currency)
 			if err != nil {
-				log.Println("Invalid bid. Usage: bid [amount]")
-				fmt.Println("Invalid bid. Usage: bid [amount]")
+				fmt.Printf("Invalid bid: %v. Usage: bid [amount], like bid 12.50\n", err)
 				continue
 			}
-			log.Printf("Client made a bid of %d", amount)
-			sendBid(int32(amount), clients)
+			sendBid(auctionFrontend, amount)
 		} else if parts[0] == "result" {
-			outcome, err := getResults(clients)
+			outcome, err := getResults(auctionFrontend)
 			if err != nil {
-				log.Println("Error fetching results:", err)
+				slog.Warn("fetching results failed", "err", err)
 				fmt.Println("Error fetching results:", err)
 				continue
 			}
-			if outcome.Result == "Auction over" {
-				log.Println("The auction is over!")
-				log.Printf("The winner is: %s with a bid of %d\n", outcome.HighestBidder, outcome.HighestBid)
-
+			currency = outcome.Currency
+			if outcome.Over {
 				fmt.Println("The auction is over!")
-				fmt.Printf("The winner is: %s with a bid of %d\n", outcome.HighestBidder, outcome.HighestBid)
+				fmt.Printf("The winner is: %s with a bid of %s\n", outcome.HighestBidder, money.Format(outcome.HighestBid, outcome.Currency))
 			} else {
-				log.Println("The auction is ongoing")
-				log.Printf("The current highest bid is %d by %s\n", outcome.HighestBid, outcome.HighestBidder)
-
 				fmt.Println("The auction is ongoing")
-				fmt.Printf("The current highest bid is %d by %s\n", outcome.HighestBid, outcome.HighestBidder)
+				fmt.Printf("The current highest bid is %s by %s\n", money.Format(outcome.HighestBid, outcome.Currency), outcome.HighestBidder)
 			}
 		} else {
-			log.Println("Unknown command, please type bid [amount] or results")
+			fmt.Println("Unknown command, please type bid [amount] or result")
 		}
 	}
 }
 
-// Sends a bid to all servers
-func sendBid(amount int32, clients []proto.AuctionServerClient) {
-	for _, client := range clients {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		req := &proto.Amount{
-			Amount:    amount,
-			Bidder:    bidder,
-			Timestamp: int32(time.Now().UnixNano()),
-		}
+// Sends a bid of amount minor units of the auction's currency to the first
+// server that answers. The servers pass it on to their leader, so one
+// answer is enough.
+func sendBid(f *frontend.Frontend, amount int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req := &proto.Amount{
+		Amount:    amount,
+		Bidder:    bidder,
+		Timestamp: int32(time.Now().UnixNano()),
+		Token:     token,
+		Auction:   *auction,
+		Currency:  currency,
+	}
 
-		ack, err := client.Bid(ctx, req)
-		if err != nil {
-			log.Println("Failed to send bid to a server")
-			fmt.Println("Failed to send bid to a server")
-			continue
-		}
-		if ack.Ack == "success" {
-			log.Println("Bid was successful")
-			fmt.Println("Bid was successful")
-		} else {
-			log.Println("Bid failed:", ack.Ack)
-			fmt.Println("Bid failed:", ack.Ack)
-		}
+	// the servers log the bid under the same request ID, and trace it as
+	// part of this span
+	ctx = logging.WithRequestID(ctx, logging.NewRequestID())
+	ctx, span := tracer.Start(ctx, "bid", trace.WithAttributes(
+		attribute.String("bidder", bidder), attribute.Int64("amount", amount), attribute.String("currency", currency),
+		attribute.String("request", logging.RequestID(ctx))))
+	defer span.End()
+	ack, err := f.Bid(ctx, req)
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		slog.WarnContext(ctx, "bid not accepted", "amount", amount, "err", err)
+		fmt.Println("Bid was not accepted:", status.Convert(err).Message())
+		return
+	}
+	slog.InfoContext(ctx, "bid", "amount", amount, "ack", ack.Ack)
+	if ack.Ack == "success" {
+		fmt.Printf("Bid of %s was successful\n", money.Format(amount, currency))
+	} else {
+		fmt.Println("Bid failed:", ack.Ack)
 	}
 }
 
-// Fetches results from all servers and returns the first valid result
-func getResults(clients []proto.AuctionServerClient) (*proto.Outcome, error) {
-	var results []*proto.Outcome
-
-	for _, client := range clients {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+// Registers the bidder name and returns the token for it
+func register(f *frontend.Frontend, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-		outcome, err := client.Result(ctx, &proto.Empty{})
-		if err != nil {
-			log.Println("Failed to fetch result from a server")
-			fmt.Println("Failed to fetch result from a server")
-			continue
-		}
-		results = append(results, outcome)
+	creds, err := f.Register(ctx, name)
+	if err != nil {
+		return "", err
 	}
+	return creds.Token, nil
+}
 
-	if len(results) == 0 {
-		return nil, fmt.Errorf("no results received from any server")
-	}
+// Checks the token of an earlier registration and gets a new access token
+func login(f *frontend.Frontend, name, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := f.Login(ctx, name, token)
+	return err
+}
+
+// Fetches the result from the first server that answers
+func getResults(f *frontend.Frontend) (*proto.Outcome, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	return results[0], nil
+	return f.Result(ctx, *auction)
 }
@@ -0,0 +1,150 @@
+// cluster runs a whole cluster of servers from one terminal and shows their
+// logs, each line prefixed with the node it comes from.
+//
+//	go run .
+//	go run . -cluster :50051,:50052,:50053,:50054,:50055 -- -token-key /path/to/token.key
+//
+// While it runs, it reads commands from standard input:
+//
+//	stop <node>     shut a node down with SIGTERM
+//	kill <node>     crash a node with SIGKILL
+//	restart <node>  kill a node if it runs and start it again
+//	start <node>    start a node that is down
+//	status          list the nodes and whether they run
+//	quit            stop every node and exit, like Ctrl+C
+//
+// Nodes are numbered from 0 in the order of -cluster. Flags after -- are
+// passed to every server.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"Replication/launcher"
+)
+
+var (
+	cluster     = flag.String("cluster", ":50051,:50052,:50053", "Comma-separated addresses of the servers to start, like the servers' -cluster")
+	serverBin   = flag.String("server-bin", "", "Server binary to run, built from ../server if empty")
+	dir         = flag.String("dir", "", "Directory for the nodes to run in, a temporary one if empty")
+	stopTimeout = flag.Duration("stop-timeout", 5*time.Second, "How long a stopping node gets before it is killed")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: cluster [flags] [-- server flags]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	work := *dir
+	if work == "" {
+		var err error
+		if work, err = os.MkdirTemp("", "cluster"); err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(work)
+	}
+	binary := *serverBin
+	if binary == "" {
+		log.Println("Building the server...")
+		var err error
+		if binary, err = launcher.Build(work); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var addrs []string
+	for _, addr := range strings.Split(*cluster, ",") {
+		addrs = append(addrs, strings.TrimSpace(addr))
+	}
+	c := launcher.WithAddrs(binary, work, addrs, flag.Args()...)
+	if err := c.StartAll(); err != nil {
+		c.StopAll(*stopTimeout)
+		log.Fatal(err)
+	}
+	fmt.Printf("Started %d nodes. Commands: stop, kill, restart, start <node>, status, quit\n", len(addrs))
+
+	commands := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			commands <- scanner.Text()
+		}
+		close(commands)
+	}()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+loop:
+	for {
+		select {
+		case line, ok := <-commands:
+			if !ok || !run(c, strings.Fields(line)) {
+				break loop
+			}
+		case <-interrupt:
+			break loop
+		}
+	}
+
+	fmt.Println("Stopping all nodes...")
+	c.StopAll(*stopTimeout)
+}
+
+// run carries out one command and reports whether to go on.
+func run(c *launcher.Cluster, words []string) bool {
+	if len(words) == 0 {
+		return true
+	}
+	switch words[0] {
+	case "quit", "exit":
+		return false
+	case "status":
+		for i, addr := range c.Addrs {
+			state := "down"
+			if c.Running(i) {
+				state = "running"
+			}
+			fmt.Printf("%s %s %s\n", c.Name(i), addr, state)
+		}
+		return true
+	case "stop", "kill", "restart", "start":
+	default:
+		fmt.Printf("Unknown command %q\n", words[0])
+		return true
+	}
+
+	if len(words) != 2 {
+		fmt.Printf("usage: %s <node>\n", words[0])
+		return true
+	}
+	i, err := strconv.Atoi(strings.TrimPrefix(words[1], "node"))
+	if err != nil || i < 0 || i >= len(c.Addrs) {
+		fmt.Printf("There is no node %s\n", words[1])
+		return true
+	}
+	switch words[0] {
+	case "stop":
+		err = c.Stop(i, *stopTimeout)
+	case "kill":
+		err = c.Kill(i)
+	case "restart":
+		err = c.Restart(i)
+	case "start":
+		err = c.Start(i)
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	return true
+}
@@ -0,0 +1,176 @@
+// Package faults makes the network between replicas misbehave on purpose.
+// An Injector sits on a replica's connections to the other replicas and
+// drops, delays, duplicates or reorders calls according to its rules.
+package faults
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	proto "Replication/grpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	gproto "google.golang.org/protobuf/proto"
+)
+
+// Injector applies fault rules to the calls a replica makes. It also serves
+// the Faults service, so the rules can be changed while the replica runs.
+type Injector struct {
+	proto.UnimplementedFaultsServer
+	id string
+
+	mutex sync.Mutex
+	rules []*proto.FaultRule
+	rand  *rand.Rand
+}
+
+// NewInjector creates an injector without rules for the replica with address
+// id. seed fixes the random choices, so a run can be repeated.
+func NewInjector(id string, seed int64) *Injector {
+	return &Injector{id: id, rand: rand.New(rand.NewSource(seed))}
+}
+
+// LoadRules reads rules from a JSON file in the form of FaultRules, for
+// example {"rules": [{"from": ":50051", "to": "*", "drop": 0.2}]}.
+func LoadRules(path string) (*proto.FaultRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := &proto.FaultRules{}
+	if err := protojson.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, Validate(rules)
+}
+
+// Validate checks that probabilities lie between 0 and 1 and that no delay
+// is negative.
+func Validate(rules *proto.FaultRules) error {
+	for i, r := range rules.Rules {
+		for _, p := range []float64{r.Drop, r.Duplicate, r.Reorder} {
+			if p < 0 || p > 1 {
+				return fmt.Errorf("rule %d: probability %v is not between 0 and 1", i, p)
+			}
+		}
+		if r.DelayMillis < 0 || r.JitterMillis < 0 || r.ReorderMillis < 0 {
+			return fmt.Errorf("rule %d: delays cannot be negative", i)
+		}
+	}
+	return nil
+}
+
+// Set replaces the rules.
+func (in *Injector) Set(rules *proto.FaultRules) error {
+	if err := Validate(rules); err != nil {
+		return err
+	}
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	in.rules = gproto.Clone(rules).(*proto.FaultRules).Rules
+	return nil
+}
+
+// Rules returns a copy of the current rules.
+func (in *Injector) Rules() *proto.FaultRules {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	return gproto.Clone(&proto.FaultRules{Rules: in.rules}).(*proto.FaultRules)
+}
+
+func (in *Injector) SetFaults(ctx context.Context, req *proto.FaultRules) (*proto.Ack, error) {
+	if err := in.Set(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &proto.Ack{Ack: "success"}, nil
+}
+
+func (in *Injector) GetFaults(ctx context.Context, req *proto.Empty) (*proto.FaultRules, error) {
+	return in.Rules(), nil
+}
+
+// fault is what happens to one call.
+type fault struct {
+	drop      bool
+	duplicate bool
+	wait      time.Duration
+}
+
+// decide picks the fault for a call to the replica at to, using the first
+// rule that matches.
+func (in *Injector) decide(to, method string) fault {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	for _, r := range in.rules {
+		if !matchAddr(r.From, in.id) || !matchAddr(r.To, to) || !matchMethod(r.Methods, method) {
+			continue
+		}
+		f := fault{
+			drop:      in.rand.Float64() < r.Drop,
+			duplicate: in.rand.Float64() < r.Duplicate,
+			wait:      time.Duration(r.DelayMillis) * time.Millisecond,
+		}
+		if r.JitterMillis > 0 {
+			f.wait += time.Duration(in.rand.Int63n(r.JitterMillis+1)) * time.Millisecond
+		}
+		if r.ReorderMillis > 0 && in.rand.Float64() < r.Reorder {
+			f.wait += time.Duration(in.rand.Int63n(r.ReorderMillis+1)) * time.Millisecond
+		}
+		return f
+	}
+	return fault{}
+}
+
+func matchAddr(pattern, addr string) bool {
+	return pattern == "" || pattern == "*" || pattern == addr
+}
+
+// matchMethod accepts both full method names and just the method's name,
+// like AppendEntries.
+func matchMethod(methods []string, method string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if m == method || strings.HasSuffix(method, "/"+m) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryClientInterceptor applies the rules to calls on connections to other
+// replicas. The target of the connection is taken as the address of the
+// replica called.
+func (in *Injector) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		f := in.decide(cc.Target(), method)
+		if f.wait > 0 {
+			timer := time.NewTimer(f.wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return status.FromContextError(ctx.Err()).Err()
+			}
+		}
+		if f.drop {
+			return status.Error(codes.Unavailable, "dropped by fault injection")
+		}
+		if f.duplicate {
+			// the first copy's answer is lost, the caller only sees the second
+			extra := gproto.Clone(reply.(gproto.Message))
+			invoker(ctx, method, req, extra, cc, opts...)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
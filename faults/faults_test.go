@@ -0,0 +1,84 @@
+package faults
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	proto "Replication/grpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// call runs one call to the replica at to through the injector and returns
+// how often it reached the network.
+func call(t *testing.T, in *Injector, to, method string) (int, error) {
+	t.Helper()
+	cc, err := grpc.Dial(to, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer cc.Close()
+
+	sent := 0
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent++
+		return nil
+	}
+	err = in.UnaryClientInterceptor()(context.Background(), method, &proto.Empty{}, &proto.Ack{}, cc, invoker)
+	return sent, err
+}
+
+func TestRulesMatchLinksAndMethods(t *testing.T) {
+	in := NewInjector("a", 1)
+	in.Set(&proto.FaultRules{Rules: []*proto.FaultRule{
+		{From: "a", To: "b", Methods: []string{"AppendEntries"}, Drop: 1},
+		{From: "b", Drop: 1},
+		{To: "c", Duplicate: 1},
+	}})
+
+	tests := []struct {
+		to, method string
+		sent       int
+		code       codes.Code
+	}{
+		{"b", proto.Replica_AppendEntries_FullMethodName, 0, codes.Unavailable},
+		{"b", proto.Replica_RequestVote_FullMethodName, 1, codes.OK},
+		{"c", proto.Replica_AppendEntries_FullMethodName, 2, codes.OK},
+		{"d", proto.AuctionServer_Bid_FullMethodName, 1, codes.OK},
+	}
+	for _, tt := range tests {
+		sent, err := call(t, in, tt.to, tt.method)
+		if sent != tt.sent || status.Code(err) != tt.code {
+			t.Errorf("call to %s %s: sent %d times with %v, want %d times with %v", tt.to, tt.method, sent, status.Code(err), tt.sent, tt.code)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	in := NewInjector("a", 1)
+	in.Set(&proto.FaultRules{Rules: []*proto.FaultRule{{DelayMillis: 50}}})
+
+	start := time.Now()
+	if _, err := call(t, in, "b", proto.Replica_AppendEntries_FullMethodName); err != nil {
+		t.Fatalf("delayed call: %v", err)
+	}
+	if took := time.Since(start); took < 50*time.Millisecond {
+		t.Errorf("call took %v, want at least 50ms", took)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	in := NewInjector("a", 1)
+	for _, r := range []*proto.FaultRule{{Drop: 1.5}, {Reorder: -0.1}, {DelayMillis: -1}} {
+		if _, err := in.SetFaults(context.Background(), &proto.FaultRules{Rules: []*proto.FaultRule{r}}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("rule %v: got %v, want InvalidArgument", r, err)
+		}
+	}
+	if len(in.Rules().Rules) != 0 {
+		t.Error("invalid rules were kept")
+	}
+}
@@ -0,0 +1,274 @@
+// Package frontend is the client side of the auction. It sends each request
+// to the first server that answers, skipping those whose health service
+// reports them as not serving, so callers do not have to care which replicas
+// are up. It can record every call for the linearizability checker.
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	proto "Replication/grpc"
+	"Replication/history"
+	"Replication/security"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Frontend holds a connection to every server.
+type Frontend struct {
+	addrs     []string
+	conns     []*grpc.ClientConn
+	clients   []proto.AuctionServerClient
+	unhealthy []atomic.Bool // set while a server reports it is not serving
+	token     *security.BearerToken
+	recorder  *history.Recorder
+	stop      context.CancelFunc
+}
+
+// Dial connects to the servers at addrs. bearer is sent with every call
+// until Register replaces it, and may be empty.
+func Dial(addrs []string, bearer string, opts ...grpc.DialOption) (*Frontend, error) {
+	f := &Frontend{token: security.NewBearerToken(bearer)}
+	opts = append(opts, grpc.WithPerRPCCredentials(f.token))
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		conn, err := grpc.Dial(addr, opts...)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("connect to %s: %w", addr, err)
+		}
+		f.addrs = append(f.addrs, addr)
+		f.conns = append(f.conns, conn)
+		f.clients = append(f.clients, proto.NewAuctionServerClient(conn))
+	}
+	if len(f.clients) == 0 {
+		return nil, fmt.Errorf("no servers to connect to")
+	}
+
+	var ctx context.Context
+	ctx, f.stop = context.WithCancel(context.Background())
+	f.unhealthy = make([]atomic.Bool, len(f.clients))
+	for i := range f.conns {
+		go f.watchHealth(ctx, i)
+	}
+	return f, nil
+}
+
+func (f *Frontend) Close() {
+	if f.stop != nil {
+		f.stop()
+	}
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+}
+
+// Record makes the frontend record every Bid and Result call to r.
+func (f *Frontend) Record(r *history.Recorder) {
+	f.recorder = r
+}
+
+// Register claims a bidder name. If the servers hand out an access token it
+// is sent with every later call.
+func (f *Frontend) Register(ctx context.Context, name string) (*proto.Credentials, error) {
+	var creds *proto.Credentials
+	err := f.each(func(client proto.AuctionServerClient) error {
+		var err error
+		creds, err = client.Register(ctx, &proto.Registration{Bidder: name})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if creds.AccessToken != "" {
+		f.token.Set(creds.AccessToken)
+	}
+	return creds, nil
+}
+
+// Login gets a new access token for a bidder that registered earlier, and
+// sends it with every later call like Register does.
+func (f *Frontend) Login(ctx context.Context, name, token string) (*proto.Credentials, error) {
+	var creds *proto.Credentials
+	err := f.each(func(client proto.AuctionServerClient) error {
+		var err error
+		creds, err = client.Login(ctx, &proto.Credentials{Bidder: name, Token: token})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if creds.AccessToken != "" {
+		f.token.Set(creds.AccessToken)
+	}
+	return creds, nil
+}
+
+func (f *Frontend) Bid(ctx context.Context, req *proto.Amount) (*proto.Ack, error) {
+	var ack *proto.Ack
+	err := f.each(func(client proto.AuctionServerClient) error {
+		id := f.invoke(history.Input{Op: history.OpBid, Auction: req.Auction, Bidder: req.Bidder, Amount: req.Amount})
+		var err error
+		ack, err = client.Bid(ctx, req)
+		if err != nil {
+			f.complete(id, history.Output{Error: err.Error()})
+		} else {
+			f.complete(id, history.Output{Ack: ack.Ack})
+		}
+		return err
+	})
+	return ack, err
+}
+
+func (f *Frontend) Result(ctx context.Context, auction string) (*proto.Outcome, error) {
+	var outcome *proto.Outcome
+	err := f.each(func(client proto.AuctionServerClient) error {
+		id := f.invoke(history.Input{Op: history.OpResult, Auction: auction})
+		var err error
+		outcome, err = client.Result(ctx, &proto.AuctionRef{Auction: auction})
+		if err != nil {
+			f.complete(id, history.Output{Error: err.Error()})
+		} else {
+			f.complete(id, history.Output{
+				HighestBidder: outcome.HighestBidder,
+				HighestBid:    outcome.HighestBid,
+				Over:          outcome.Over,
+			})
+		}
+		return err
+	})
+	return outcome, err
+}
+
+// Watch calls fn with every event of an auction, starting with its state,
+// until the auction is over, fn returns an error or ctx ends. If the server
+// it watches fails it goes on with another one, skipping the events it has
+// already seen.
+func (f *Frontend) Watch(ctx context.Context, auction string, fn func(*proto.Event) error) error {
+	last := int64(-1)
+	var stop error // from fn, which must not be retried
+	err := f.each(func(client proto.AuctionServerClient) error {
+		stream, err := client.Watch(ctx, &proto.AuctionRef{Auction: auction})
+		if err != nil {
+			return err
+		}
+		for {
+			ev, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			// a new server sends its state first, which is news unless it
+			// is behind
+			if ev.Index < last || ev.Index == last && ev.Kind != "state" {
+				continue
+			}
+			last = ev.Index
+			if stop = fn(ev); stop != nil {
+				return nil
+			}
+		}
+	})
+	if stop != nil {
+		return stop
+	}
+	return err
+}
+
+// each calls try with one server after the other until one gives an answer.
+// Errors that another server would give too, like a wrong token, are
+// returned right away.
+func (f *Frontend) each(try func(proto.AuctionServerClient) error) error {
+	var err error
+	for _, client := range f.healthy() {
+		err = try(client)
+		if !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// healthy returns the servers that have not said they are not serving. If
+// none are left, as while the replicas elect a leader, it returns them all.
+func (f *Frontend) healthy() []proto.AuctionServerClient {
+	var clients []proto.AuctionServerClient
+	for i, client := range f.clients {
+		if !f.unhealthy[i].Load() {
+			clients = append(clients, client)
+		}
+	}
+	if len(clients) == 0 {
+		return f.clients
+	}
+	return clients
+}
+
+// watchHealth follows the health of server i until the frontend is closed.
+// A server that cannot be reached counts as not serving, one without a
+// health service as serving.
+func (f *Frontend) watchHealth(ctx context.Context, i int) {
+	client := healthpb.NewHealthClient(f.conns[i])
+	req := &healthpb.HealthCheckRequest{Service: proto.AuctionServer_ServiceDesc.ServiceName}
+	for {
+		stream, err := client.Watch(ctx, req)
+		for err == nil {
+			var reply *healthpb.HealthCheckResponse
+			if reply, err = stream.Recv(); err == nil {
+				f.unhealthy[i].Store(reply.Status != healthpb.HealthCheckResponse_SERVING)
+			}
+		}
+		if status.Code(err) == codes.Unimplemented {
+			f.unhealthy[i].Store(false)
+			return
+		}
+		f.unhealthy[i].Store(true)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(healthRetry):
+		}
+	}
+}
+
+// healthRetry is how long to wait before watching a server's health again
+// after the watch broke off.
+const healthRetry = 500 * time.Millisecond
+
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Unknown, codes.Internal:
+		return true
+	}
+	return false
+}
+
+func (f *Frontend) invoke(in history.Input) int64 {
+	if f.recorder == nil {
+		return 0
+	}
+	if in.Auction == "" {
+		in.Auction = "default"
+	}
+	return f.recorder.Invoke(in)
+}
+
+func (f *Frontend) complete(id int64, out history.Output) {
+	if f.recorder != nil {
+		f.recorder.Complete(id, out)
+	}
+}
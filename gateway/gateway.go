@@ -0,0 +1,269 @@
+// gateway offers the auction over HTTP and JSON, for clients that cannot
+// speak gRPC. It runs in front of the servers and passes every request on to
+// the first one that answers.
+//
+//	go run . -listen :8080
+//	curl -X POST localhost:8080/auctions/default/bids -d '{"bidder": "anna", "token": "...", "amount": 1250, "currency": "DKK"}'
+//	curl localhost:8080/auctions/default/result
+//	curl -N localhost:8080/auctions/default/events
+//
+// Amounts are in minor units of the auction's currency, so an amount of
+// 1250 in a DKK auction is 12.50 DKK. A bearer token in the Authorization
+// header is passed on to the servers.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"Replication/frontend"
+	proto "Replication/grpc"
+	"Replication/security"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	listen     = flag.String("listen", ":8080", "Address to serve HTTP on")
+	servers    = flag.String("servers", ":50051,:50052,:50053", "Comma-separated server addresses")
+	caFile     = flag.String("ca", "", "CA that signed the server certificates, turns on TLS")
+	serverName = flag.String("server-name", "localhost", "Name in the server certificates")
+)
+
+func main() {
+	flag.Parse()
+
+	dialOpt, err := security.TLSFiles{CA: *caFile, ServerName: *serverName}.DialOption()
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+	f, err := frontend.Dial(strings.Split(*servers, ","), "", dialOpt)
+	if err != nil {
+		log.Fatalf("Failed to connect to the servers: %v", err)
+	}
+	defer f.Close()
+
+	log.Printf("Serving HTTP on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, newHandler(f)))
+}
+
+// auctions is the part of the frontend the gateway uses.
+type auctions interface {
+	Bid(ctx context.Context, req *proto.Amount) (*proto.Ack, error)
+	Result(ctx context.Context, auction string) (*proto.Outcome, error)
+	Watch(ctx context.Context, auction string, fn func(*proto.Event) error) error
+}
+
+// requestTimeout bounds how long a request may wait for the servers.
+const requestTimeout = 10 * time.Second
+
+func newHandler(backend auctions) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auctions/{id}/bids", func(w http.ResponseWriter, r *http.Request) {
+		var body bidRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if body.Bidder == "" || body.Amount <= 0 {
+			writeError(w, http.StatusBadRequest, "a bid needs a bidder and a positive amount")
+			return
+		}
+
+		ctx, cancel := callContext(r)
+		defer cancel()
+		// the gateway has no Lamport clock, so the timestamp is left at 0
+		// and the leader gives the bid the next tick of its own
+		ack, err := backend.Bid(ctx, &proto.Amount{
+			Amount:   body.Amount,
+			Bidder:   body.Bidder,
+			Token:    body.Token,
+			Auction:  r.PathValue("id"),
+			Currency: body.Currency,
+		})
+		if err != nil {
+			writeStatus(w, err)
+			return
+		}
+		code, outcome := bidOutcome(ack.Ack)
+		writeJSON(w, code, bidReply{Accepted: code == http.StatusCreated, Outcome: outcome, Message: ack.Ack})
+	})
+	mux.HandleFunc("GET /auctions/{id}/result", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := callContext(r)
+		defer cancel()
+		id := r.PathValue("id")
+		outcome, err := backend.Result(ctx, id)
+		if err != nil {
+			writeStatus(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resultReply{
+			Auction:       id,
+			Over:          outcome.Over,
+			HighestBid:    outcome.HighestBid,
+			HighestBidder: outcome.HighestBidder,
+			Currency:      outcome.Currency,
+			Result:        outcome.Result,
+		})
+	})
+	mux.HandleFunc("GET /auctions/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "streaming is not supported")
+			return
+		}
+		// the headers go out with the first event, so errors before it can
+		// still get a status of their own
+		started := false
+		err := backend.Watch(withToken(r), r.PathValue("id"), func(ev *proto.Event) error {
+			if !started {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+				w.WriteHeader(http.StatusOK)
+				started = true
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		})
+		if err != nil && !started {
+			writeStatus(w, err)
+		}
+	})
+	return mux
+}
+
+type bidRequest struct {
+	Bidder   string `json:"bidder"`
+	Token    string `json:"token"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"` // the auction's if empty
+}
+
+type bidReply struct {
+	Accepted bool   `json:"accepted"`
+	Outcome  string `json:"outcome"` // accepted, too_low or closed
+	Message  string `json:"message"`
+}
+
+type resultReply struct {
+	Auction       string `json:"auction"`
+	Over          bool   `json:"over"`
+	HighestBid    int64  `json:"highestBid"`
+	HighestBidder string `json:"highestBidder"`
+	Currency      string `json:"currency"`
+	Result        string `json:"result"`
+}
+
+// eventReply is an event as sent to the browser, in the data field of a
+// server-sent event named after its kind.
+type eventReply struct {
+	Auction       string `json:"auction"`
+	Index         int64  `json:"index"`
+	Bidder        string `json:"bidder,omitempty"`
+	Amount        int64  `json:"amount,omitempty"`
+	Accepted      bool   `json:"accepted,omitempty"`
+	Outbid        string `json:"outbid,omitempty"`
+	HighestBid    int64  `json:"highestBid"`
+	HighestBidder string `json:"highestBidder"`
+	Over          bool   `json:"over"`
+	Currency      string `json:"currency"`
+}
+
+// writeEvent writes ev as a server-sent event. Its id is the log index the
+// event comes from.
+func writeEvent(w io.Writer, ev *proto.Event) error {
+	data, err := json.Marshal(eventReply{
+		Auction:       ev.Auction,
+		Index:         ev.Index,
+		Bidder:        ev.Bidder,
+		Amount:        ev.Amount,
+		Accepted:      ev.Accepted,
+		Outbid:        ev.Outbid,
+		HighestBid:    ev.HighestBid,
+		HighestBidder: ev.HighestBidder,
+		Over:          ev.Over,
+		Currency:      ev.Currency,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Index, ev.Kind, data)
+	return err
+}
+
+// callContext bounds the call to the servers and passes the caller's bearer
+// token on.
+func callContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(withToken(r), requestTimeout)
+}
+
+// withToken passes the caller's bearer token on to the servers.
+func withToken(r *http.Request) context.Context {
+	ctx := r.Context()
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", auth)
+	}
+	return ctx
+}
+
+// bidOutcome maps the servers' answer to a bid to an HTTP status: 201 for an
+// accepted bid, 409 for one that is not higher than the highest bid and 410
+// for a bid in an auction that is over.
+func bidOutcome(ack string) (int, string) {
+	switch ack {
+	case "success":
+		return http.StatusCreated, "accepted"
+	case "fail":
+		return http.StatusGone, "closed"
+	}
+	return http.StatusConflict, "too_low"
+}
+
+// httpStatus maps a gRPC error to an HTTP status.
+func httpStatus(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded, codes.Canceled:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func writeStatus(w http.ResponseWriter, err error) {
+	writeError(w, httpStatus(err), status.Convert(err).Message())
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
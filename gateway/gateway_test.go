@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	proto "Replication/grpc"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAuctions answers like a server would, from a fixed highest bid.
+type fakeAuctions struct {
+	highest int64 // in minor units
+	over    bool
+	auth    string // authorization metadata of the last call
+}
+
+func (f *fakeAuctions) Bid(ctx context.Context, req *proto.Amount) (*proto.Ack, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	f.auth = strings.Join(md.Get("authorization"), ",")
+	switch {
+	case req.Auction != "default":
+		return nil, status.Errorf(codes.NotFound, "no auction called %s", req.Auction)
+	case req.Token != "secret":
+		return nil, status.Error(codes.Unauthenticated, "wrong token")
+	case req.Timestamp != 0:
+		return nil, status.Errorf(codes.InvalidArgument, "gateway sent timestamp %d, want 0", req.Timestamp)
+	case req.Currency != "" && req.Currency != "DKK":
+		return nil, status.Errorf(codes.InvalidArgument, "auction default takes bids in DKK, not %s", req.Currency)
+	case f.over:
+		return &proto.Ack{Ack: "fail"}, nil
+	case req.Amount <= f.highest:
+		return &proto.Ack{Ack: "BidException: Your bid was too low ;("}, nil
+	}
+	f.highest = req.Amount
+	return &proto.Ack{Ack: "success"}, nil
+}
+
+func (f *fakeAuctions) Result(ctx context.Context, auction string) (*proto.Outcome, error) {
+	if auction != "default" {
+		return nil, status.Errorf(codes.NotFound, "no auction called %s", auction)
+	}
+	if f.over {
+		return &proto.Outcome{Result: "Auction over, the highest bidder was anna", HighestBid: f.highest, HighestBidder: "anna", Currency: "DKK", Over: true}, nil
+	}
+	return &proto.Outcome{Result: "Auction is ongoing, the highest bidder is anna", HighestBid: f.highest, HighestBidder: "anna", Currency: "DKK"}, nil
+}
+
+// Watch sends the state and then a bid and the close.
+func (f *fakeAuctions) Watch(ctx context.Context, auction string, fn func(*proto.Event) error) error {
+	if auction != "default" {
+		return status.Errorf(codes.NotFound, "no auction called %s", auction)
+	}
+	for _, ev := range []*proto.Event{
+		{Kind: "state", Auction: auction, Index: 3, HighestBid: f.highest, HighestBidder: "anna", Currency: "DKK"},
+		{Kind: "bid", Auction: auction, Index: 4, Bidder: "bo", Amount: f.highest + 1, Accepted: true, Outbid: "anna", HighestBid: f.highest + 1, HighestBidder: "bo", Currency: "DKK"},
+		{Kind: "close", Auction: auction, Index: 5, HighestBid: f.highest + 1, HighestBidder: "bo", Over: true, Currency: "DKK"},
+	} {
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestBidStatusCodes(t *testing.T) {
+	fake := &fakeAuctions{highest: 10}
+	h := newHandler(fake)
+
+	tests := []struct {
+		auction, body string
+		over          bool
+		code          int
+		outcome       string
+	}{
+		{"default", `{"bidder": "anna", "token": "secret", "amount": 20}`, false, http.StatusCreated, "accepted"},
+		{"default", `{"bidder": "anna", "token": "secret", "amount": 20}`, false, http.StatusConflict, "too_low"},
+		{"default", `{"bidder": "anna", "token": "secret", "amount": 30}`, true, http.StatusGone, "closed"},
+		{"default", `{"bidder": "anna", "token": "wrong", "amount": 30}`, false, http.StatusUnauthorized, ""},
+		{"spring", `{"bidder": "anna", "token": "secret", "amount": 30}`, false, http.StatusNotFound, ""},
+		{"default", `{"bidder": "anna", "token": "secret", "amount": 40, "currency": "EUR"}`, false, http.StatusBadRequest, ""},
+		{"default", `{"bidder": "anna", "token": "secret", "amount": 40, "currency": "DKK"}`, false, http.StatusCreated, "accepted"},
+		{"default", `{"bidder": "anna", "amount": -1}`, false, http.StatusBadRequest, ""},
+		{"default", `not json`, false, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		fake.over = tt.over
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/auctions/"+tt.auction+"/bids", strings.NewReader(tt.body)))
+		if rec.Code != tt.code {
+			t.Errorf("bid %s in %s: got status %d, want %d (%s)", tt.body, tt.auction, rec.Code, tt.code, rec.Body)
+			continue
+		}
+		var reply bidReply
+		json.Unmarshal(rec.Body.Bytes(), &reply)
+		if reply.Outcome != tt.outcome {
+			t.Errorf("bid %s in %s: got outcome %q, want %q", tt.body, tt.auction, reply.Outcome, tt.outcome)
+		}
+	}
+}
+
+func TestResult(t *testing.T) {
+	h := newHandler(&fakeAuctions{highest: 10, over: true})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/auctions/default/result", nil))
+	var reply resultReply
+	if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("result: got %d %s", rec.Code, rec.Body)
+	}
+	if !reply.Over || reply.HighestBid != 10 || reply.HighestBidder != "anna" || reply.Auction != "default" || reply.Currency != "DKK" {
+		t.Errorf("result: got %+v", reply)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/auctions/spring/result", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("result of an unknown auction: got status %d", rec.Code)
+	}
+}
+
+func TestBearerTokenIsPassedOn(t *testing.T) {
+	fake := &fakeAuctions{}
+	req := httptest.NewRequest("POST", "/auctions/default/bids", strings.NewReader(`{"bidder": "anna", "token": "secret", "amount": 5}`))
+	req.Header.Set("Authorization", "Bearer abc")
+	newHandler(fake).ServeHTTP(httptest.NewRecorder(), req)
+	if fake.auth != "Bearer abc" {
+		t.Errorf("servers got authorization %q", fake.auth)
+	}
+}
+
+func TestEventsStream(t *testing.T) {
+	h := newHandler(&fakeAuctions{highest: 10})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/auctions/default/events", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events: got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	want := `id: 3
+event: state
+data: {"auction":"default","index":3,"highestBid":10,"highestBidder":"anna","over":false,"currency":"DKK"}
+
+id: 4
+event: bid
+data: {"auction":"default","index":4,"bidder":"bo","amount":11,"accepted":true,"outbid":"anna","highestBid":11,"highestBidder":"bo","over":false,"currency":"DKK"}
+
+id: 5
+event: close
+data: {"auction":"default","index":5,"highestBid":11,"highestBidder":"bo","over":true,"currency":"DKK"}
+
+`
+	if rec.Body.String() != want {
+		t.Errorf("events: got\n%s\nwant\n%s", rec.Body, want)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/auctions/spring/events", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("events of an unknown auction: got status %d", rec.Code)
+	}
+}
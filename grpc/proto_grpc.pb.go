@@ -19,8 +19,17 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	AuctionServer_Bid_FullMethodName    = "/proto.AuctionServer/Bid"
-	AuctionServer_Result_FullMethodName = "/proto.AuctionServer/Result"
+	AuctionServer_Bid_FullMethodName           = "/proto.AuctionServer/Bid"
+	AuctionServer_Result_FullMethodName        = "/proto.AuctionServer/Result"
+	AuctionServer_Register_FullMethodName      = "/proto.AuctionServer/Register"
+	AuctionServer_Login_FullMethodName         = "/proto.AuctionServer/Login"
+	AuctionServer_CreateAuction_FullMethodName = "/proto.AuctionServer/CreateAuction"
+	AuctionServer_CloseAuction_FullMethodName  = "/proto.AuctionServer/CloseAuction"
+	AuctionServer_Watch_FullMethodName         = "/proto.AuctionServer/Watch"
+	AuctionServer_AddWebhook_FullMethodName    = "/proto.AuctionServer/AddWebhook"
+	AuctionServer_RemoveWebhook_FullMethodName = "/proto.AuctionServer/RemoveWebhook"
+	AuctionServer_ListWebhooks_FullMethodName  = "/proto.AuctionServer/ListWebhooks"
+	AuctionServer_ExportAudit_FullMethodName   = "/proto.AuctionServer/ExportAudit"
 )
 
 // AuctionServerClient is the client API for AuctionServer service.
@@ -28,7 +37,29 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type AuctionServerClient interface {
 	Bid(ctx context.Context, in *Amount, opts ...grpc.CallOption) (*Ack, error)
-	Result(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Outcome, error)
+	Result(ctx context.Context, in *AuctionRef, opts ...grpc.CallOption) (*Outcome, error)
+	// Register claims a bidder name and returns the token needed to bid as it.
+	Register(ctx context.Context, in *Registration, opts ...grpc.CallOption) (*Credentials, error)
+	// Login checks the bidder and token from Register and hands out a fresh
+	// access token, as the one from Register expires.
+	Login(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*Credentials, error)
+	// CreateAuction and CloseAuction are for auctioneers only.
+	CreateAuction(ctx context.Context, in *AuctionSpec, opts ...grpc.CallOption) (*Ack, error)
+	CloseAuction(ctx context.Context, in *AuctionRef, opts ...grpc.CallOption) (*Ack, error)
+	// Watch streams what happens in an auction as the replica the call is
+	// sent to applies it. The first event is the auction's current state.
+	Watch(ctx context.Context, in *AuctionRef, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// AddWebhook, RemoveWebhook and ListWebhooks are for auctioneers only.
+	// AddWebhook has the cluster POST signed JSON to the webhook's URL on
+	// outbid, closed and winner events. Adding a URL again replaces it.
+	AddWebhook(ctx context.Context, in *Webhook, opts ...grpc.CallOption) (*Ack, error)
+	RemoveWebhook(ctx context.Context, in *Webhook, opts ...grpc.CallOption) (*Ack, error)
+	// ListWebhooks leaves out the secrets.
+	ListWebhooks(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*WebhookList, error)
+	// ExportAudit streams the audit trail of an auction as far as the
+	// replica the call is sent to has applied it. For auctioneers and
+	// admins only.
+	ExportAudit(ctx context.Context, in *AuctionRef, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AuditRecord], error)
 }
 
 type auctionServerClient struct {
@@ -49,7 +80,7 @@ func (c *auctionServerClient) Bid(ctx context.Context, in *Amount, opts ...grpc.
 	return out, nil
 }
 
-func (c *auctionServerClient) Result(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Outcome, error) {
+func (c *auctionServerClient) Result(ctx context.Context, in *AuctionRef, opts ...grpc.CallOption) (*Outcome, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(Outcome)
 	err := c.cc.Invoke(ctx, AuctionServer_Result_FullMethodName, in, out, cOpts...)
@@ -59,12 +90,142 @@ func (c *auctionServerClient) Result(ctx context.Context, in *Empty, opts ...grp
 	return out, nil
 }
 
+func (c *auctionServerClient) Register(ctx context.Context, in *Registration, opts ...grpc.CallOption) (*Credentials, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Credentials)
+	err := c.cc.Invoke(ctx, AuctionServer_Register_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionServerClient) Login(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*Credentials, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Credentials)
+	err := c.cc.Invoke(ctx, AuctionServer_Login_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionServerClient) CreateAuction(ctx context.Context, in *AuctionSpec, opts ...grpc.CallOption) (*Ack, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, AuctionServer_CreateAuction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionServerClient) CloseAuction(ctx context.Context, in *AuctionRef, opts ...grpc.CallOption) (*Ack, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, AuctionServer_CloseAuction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionServerClient) Watch(ctx context.Context, in *AuctionRef, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AuctionServer_ServiceDesc.Streams[0], AuctionServer_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AuctionRef, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AuctionServer_WatchClient = grpc.ServerStreamingClient[Event]
+
+func (c *auctionServerClient) AddWebhook(ctx context.Context, in *Webhook, opts ...grpc.CallOption) (*Ack, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, AuctionServer_AddWebhook_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionServerClient) RemoveWebhook(ctx context.Context, in *Webhook, opts ...grpc.CallOption) (*Ack, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, AuctionServer_RemoveWebhook_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionServerClient) ListWebhooks(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*WebhookList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WebhookList)
+	err := c.cc.Invoke(ctx, AuctionServer_ListWebhooks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionServerClient) ExportAudit(ctx context.Context, in *AuctionRef, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AuditRecord], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AuctionServer_ServiceDesc.Streams[1], AuctionServer_ExportAudit_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AuctionRef, AuditRecord]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AuctionServer_ExportAuditClient = grpc.ServerStreamingClient[AuditRecord]
+
 // AuctionServerServer is the server API for AuctionServer service.
 // All implementations must embed UnimplementedAuctionServerServer
 // for forward compatibility.
 type AuctionServerServer interface {
 	Bid(context.Context, *Amount) (*Ack, error)
-	Result(context.Context, *Empty) (*Outcome, error)
+	Result(context.Context, *AuctionRef) (*Outcome, error)
+	// Register claims a bidder name and returns the token needed to bid as it.
+	Register(context.Context, *Registration) (*Credentials, error)
+	// Login checks the bidder and token from Register and hands out a fresh
+	// access token, as the one from Register expires.
+	Login(context.Context, *Credentials) (*Credentials, error)
+	// CreateAuction and CloseAuction are for auctioneers only.
+	CreateAuction(context.Context, *AuctionSpec) (*Ack, error)
+	CloseAuction(context.Context, *AuctionRef) (*Ack, error)
+	// Watch streams what happens in an auction as the replica the call is
+	// sent to applies it. The first event is the auction's current state.
+	Watch(*AuctionRef, grpc.ServerStreamingServer[Event]) error
+	// AddWebhook, RemoveWebhook and ListWebhooks are for auctioneers only.
+	// AddWebhook has the cluster POST signed JSON to the webhook's URL on
+	// outbid, closed and winner events. Adding a URL again replaces it.
+	AddWebhook(context.Context, *Webhook) (*Ack, error)
+	RemoveWebhook(context.Context, *Webhook) (*Ack, error)
+	// ListWebhooks leaves out the secrets.
+	ListWebhooks(context.Context, *Empty) (*WebhookList, error)
+	// ExportAudit streams the audit trail of an auction as far as the
+	// replica the call is sent to has applied it. For auctioneers and
+	// admins only.
+	ExportAudit(*AuctionRef, grpc.ServerStreamingServer[AuditRecord]) error
 	mustEmbedUnimplementedAuctionServerServer()
 }
 
@@ -78,9 +239,36 @@ type UnimplementedAuctionServerServer struct{}
 func (UnimplementedAuctionServerServer) Bid(context.Context, *Amount) (*Ack, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Bid not implemented")
 }
-func (UnimplementedAuctionServerServer) Result(context.Context, *Empty) (*Outcome, error) {
+func (UnimplementedAuctionServerServer) Result(context.Context, *AuctionRef) (*Outcome, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Result not implemented")
 }
+func (UnimplementedAuctionServerServer) Register(context.Context, *Registration) (*Credentials, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedAuctionServerServer) Login(context.Context, *Credentials) (*Credentials, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedAuctionServerServer) CreateAuction(context.Context, *AuctionSpec) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAuction not implemented")
+}
+func (UnimplementedAuctionServerServer) CloseAuction(context.Context, *AuctionRef) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseAuction not implemented")
+}
+func (UnimplementedAuctionServerServer) Watch(*AuctionRef, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedAuctionServerServer) AddWebhook(context.Context, *Webhook) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddWebhook not implemented")
+}
+func (UnimplementedAuctionServerServer) RemoveWebhook(context.Context, *Webhook) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveWebhook not implemented")
+}
+func (UnimplementedAuctionServerServer) ListWebhooks(context.Context, *Empty) (*WebhookList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhooks not implemented")
+}
+func (UnimplementedAuctionServerServer) ExportAudit(*AuctionRef, grpc.ServerStreamingServer[AuditRecord]) error {
+	return status.Errorf(codes.Unimplemented, "method ExportAudit not implemented")
+}
 func (UnimplementedAuctionServerServer) mustEmbedUnimplementedAuctionServerServer() {}
 func (UnimplementedAuctionServerServer) testEmbeddedByValue()                       {}
 
@@ -121,7 +309,7 @@ func _AuctionServer_Bid_Handler(srv interface{}, ctx context.Context, dec func(i
 }
 
 func _AuctionServer_Result_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Empty)
+	in := new(AuctionRef)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -133,11 +321,159 @@ func _AuctionServer_Result_Handler(srv interface{}, ctx context.Context, dec fun
 		FullMethod: AuctionServer_Result_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AuctionServerServer).Result(ctx, req.(*Empty))
+		return srv.(AuctionServerServer).Result(ctx, req.(*AuctionRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionServer_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Registration)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionServerServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionServer_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionServerServer).Register(ctx, req.(*Registration))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionServer_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Credentials)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionServerServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionServer_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionServerServer).Login(ctx, req.(*Credentials))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionServer_CreateAuction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuctionSpec)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionServerServer).CreateAuction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionServer_CreateAuction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionServerServer).CreateAuction(ctx, req.(*AuctionSpec))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionServer_CloseAuction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuctionRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionServerServer).CloseAuction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionServer_CloseAuction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionServerServer).CloseAuction(ctx, req.(*AuctionRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionServer_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AuctionRef)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AuctionServerServer).Watch(m, &grpc.GenericServerStream[AuctionRef, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AuctionServer_WatchServer = grpc.ServerStreamingServer[Event]
+
+func _AuctionServer_AddWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Webhook)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionServerServer).AddWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionServer_AddWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionServerServer).AddWebhook(ctx, req.(*Webhook))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionServer_RemoveWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Webhook)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionServerServer).RemoveWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionServer_RemoveWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionServerServer).RemoveWebhook(ctx, req.(*Webhook))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionServer_ListWebhooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionServerServer).ListWebhooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionServer_ListWebhooks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionServerServer).ListWebhooks(ctx, req.(*Empty))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AuctionServer_ExportAudit_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AuctionRef)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AuctionServerServer).ExportAudit(m, &grpc.GenericServerStream[AuctionRef, AuditRecord]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AuctionServer_ExportAuditServer = grpc.ServerStreamingServer[AuditRecord]
+
 // AuctionServer_ServiceDesc is the grpc.ServiceDesc for AuctionServer service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,6 +489,663 @@ var AuctionServer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Result",
 			Handler:    _AuctionServer_Result_Handler,
 		},
+		{
+			MethodName: "Register",
+			Handler:    _AuctionServer_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _AuctionServer_Login_Handler,
+		},
+		{
+			MethodName: "CreateAuction",
+			Handler:    _AuctionServer_CreateAuction_Handler,
+		},
+		{
+			MethodName: "CloseAuction",
+			Handler:    _AuctionServer_CloseAuction_Handler,
+		},
+		{
+			MethodName: "AddWebhook",
+			Handler:    _AuctionServer_AddWebhook_Handler,
+		},
+		{
+			MethodName: "RemoveWebhook",
+			Handler:    _AuctionServer_RemoveWebhook_Handler,
+		},
+		{
+			MethodName: "ListWebhooks",
+			Handler:    _AuctionServer_ListWebhooks_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _AuctionServer_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ExportAudit",
+			Handler:       _AuctionServer_ExportAudit_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto.proto",
+}
+
+const (
+	Replica_RequestVote_FullMethodName     = "/proto.Replica/RequestVote"
+	Replica_AppendEntries_FullMethodName   = "/proto.Replica/AppendEntries"
+	Replica_InstallSnapshot_FullMethodName = "/proto.Replica/InstallSnapshot"
+)
+
+// ReplicaClient is the client API for Replica service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Replica is only used between the servers. The leader puts every bid into
+// a log and the followers apply the log in the same order, so all replicas
+// end up with the same highest bidder.
+type ReplicaClient interface {
+	RequestVote(ctx context.Context, in *VoteRequest, opts ...grpc.CallOption) (*VoteReply, error)
+	AppendEntries(ctx context.Context, in *AppendRequest, opts ...grpc.CallOption) (*AppendReply, error)
+	// InstallSnapshot replaces a follower's log with the leader's snapshot,
+	// when the leader no longer has the entries the follower is missing.
+	InstallSnapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (*AppendReply, error)
+}
+
+type replicaClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewReplicaClient(cc grpc.ClientConnInterface) ReplicaClient {
+	return &replicaClient{cc}
+}
+
+func (c *replicaClient) RequestVote(ctx context.Context, in *VoteRequest, opts ...grpc.CallOption) (*VoteReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VoteReply)
+	err := c.cc.Invoke(ctx, Replica_RequestVote_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicaClient) AppendEntries(ctx context.Context, in *AppendRequest, opts ...grpc.CallOption) (*AppendReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AppendReply)
+	err := c.cc.Invoke(ctx, Replica_AppendEntries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicaClient) InstallSnapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (*AppendReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AppendReply)
+	err := c.cc.Invoke(ctx, Replica_InstallSnapshot_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReplicaServer is the server API for Replica service.
+// All implementations must embed UnimplementedReplicaServer
+// for forward compatibility.
+//
+// Replica is only used between the servers. The leader puts every bid into
+// a log and the followers apply the log in the same order, so all replicas
+// end up with the same highest bidder.
+type ReplicaServer interface {
+	RequestVote(context.Context, *VoteRequest) (*VoteReply, error)
+	AppendEntries(context.Context, *AppendRequest) (*AppendReply, error)
+	// InstallSnapshot replaces a follower's log with the leader's snapshot,
+	// when the leader no longer has the entries the follower is missing.
+	InstallSnapshot(context.Context, *SnapshotRequest) (*AppendReply, error)
+	mustEmbedUnimplementedReplicaServer()
+}
+
+// UnimplementedReplicaServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedReplicaServer struct{}
+
+func (UnimplementedReplicaServer) RequestVote(context.Context, *VoteRequest) (*VoteReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequestVote not implemented")
+}
+func (UnimplementedReplicaServer) AppendEntries(context.Context, *AppendRequest) (*AppendReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AppendEntries not implemented")
+}
+func (UnimplementedReplicaServer) InstallSnapshot(context.Context, *SnapshotRequest) (*AppendReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InstallSnapshot not implemented")
+}
+func (UnimplementedReplicaServer) mustEmbedUnimplementedReplicaServer() {}
+func (UnimplementedReplicaServer) testEmbeddedByValue()                 {}
+
+// UnsafeReplicaServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ReplicaServer will
+// result in compilation errors.
+type UnsafeReplicaServer interface {
+	mustEmbedUnimplementedReplicaServer()
+}
+
+func RegisterReplicaServer(s grpc.ServiceRegistrar, srv ReplicaServer) {
+	// If the following call pancis, it indicates UnimplementedReplicaServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Replica_ServiceDesc, srv)
+}
+
+func _Replica_RequestVote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicaServer).RequestVote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Replica_RequestVote_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicaServer).RequestVote(ctx, req.(*VoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replica_AppendEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AppendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicaServer).AppendEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Replica_AppendEntries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicaServer).AppendEntries(ctx, req.(*AppendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replica_InstallSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicaServer).InstallSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Replica_InstallSnapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicaServer).InstallSnapshot(ctx, req.(*SnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Replica_ServiceDesc is the grpc.ServiceDesc for Replica service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Replica_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Replica",
+	HandlerType: (*ReplicaServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RequestVote",
+			Handler:    _Replica_RequestVote_Handler,
+		},
+		{
+			MethodName: "AppendEntries",
+			Handler:    _Replica_AppendEntries_Handler,
+		},
+		{
+			MethodName: "InstallSnapshot",
+			Handler:    _Replica_InstallSnapshot_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto.proto",
+}
+
+const (
+	AuctionAdmin_Status_FullMethodName       = "/proto.AuctionAdmin/Status"
+	AuctionAdmin_Snapshot_FullMethodName     = "/proto.AuctionAdmin/Snapshot"
+	AuctionAdmin_StepDown_FullMethodName     = "/proto.AuctionAdmin/StepDown"
+	AuctionAdmin_Drain_FullMethodName        = "/proto.AuctionAdmin/Drain"
+	AuctionAdmin_VerifyLedger_FullMethodName = "/proto.AuctionAdmin/VerifyLedger"
+)
+
+// AuctionAdminClient is the client API for AuctionAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// AuctionAdmin lets operators look into a replica and steer it. Every call
+// is answered by the replica it is sent to, not passed on to the leader.
+type AuctionAdminClient interface {
+	Status(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*NodeStatus, error)
+	// Snapshot compacts the replica's log into a snapshot of what it has
+	// applied so far.
+	Snapshot(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*SnapshotInfo, error)
+	// StepDown makes the leader give up its leadership and wait a while
+	// before it campaigns again, so another replica takes over.
+	StepDown(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Ack, error)
+	// Drain makes the replica turn clients away and stop campaigning, after
+	// stepping down if it leads, so it can be stopped without failing bids.
+	Drain(ctx context.Context, in *DrainRequest, opts ...grpc.CallOption) (*Ack, error)
+	// VerifyLedger checks the hash chain of the replica's log and reports
+	// the first entry that does not fit, in its own log or found while
+	// comparing chain heads with another replica.
+	VerifyLedger(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*LedgerReport, error)
+}
+
+type auctionAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAuctionAdminClient(cc grpc.ClientConnInterface) AuctionAdminClient {
+	return &auctionAdminClient{cc}
+}
+
+func (c *auctionAdminClient) Status(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*NodeStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NodeStatus)
+	err := c.cc.Invoke(ctx, AuctionAdmin_Status_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) Snapshot(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*SnapshotInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SnapshotInfo)
+	err := c.cc.Invoke(ctx, AuctionAdmin_Snapshot_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) StepDown(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Ack, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, AuctionAdmin_StepDown_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) Drain(ctx context.Context, in *DrainRequest, opts ...grpc.CallOption) (*Ack, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, AuctionAdmin_Drain_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) VerifyLedger(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*LedgerReport, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LedgerReport)
+	err := c.cc.Invoke(ctx, AuctionAdmin_VerifyLedger_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuctionAdminServer is the server API for AuctionAdmin service.
+// All implementations must embed UnimplementedAuctionAdminServer
+// for forward compatibility.
+//
+// AuctionAdmin lets operators look into a replica and steer it. Every call
+// is answered by the replica it is sent to, not passed on to the leader.
+type AuctionAdminServer interface {
+	Status(context.Context, *Empty) (*NodeStatus, error)
+	// Snapshot compacts the replica's log into a snapshot of what it has
+	// applied so far.
+	Snapshot(context.Context, *Empty) (*SnapshotInfo, error)
+	// StepDown makes the leader give up its leadership and wait a while
+	// before it campaigns again, so another replica takes over.
+	StepDown(context.Context, *Empty) (*Ack, error)
+	// Drain makes the replica turn clients away and stop campaigning, after
+	// stepping down if it leads, so it can be stopped without failing bids.
+	Drain(context.Context, *DrainRequest) (*Ack, error)
+	// VerifyLedger checks the hash chain of the replica's log and reports
+	// the first entry that does not fit, in its own log or found while
+	// comparing chain heads with another replica.
+	VerifyLedger(context.Context, *Empty) (*LedgerReport, error)
+	mustEmbedUnimplementedAuctionAdminServer()
+}
+
+// UnimplementedAuctionAdminServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAuctionAdminServer struct{}
+
+func (UnimplementedAuctionAdminServer) Status(context.Context, *Empty) (*NodeStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedAuctionAdminServer) Snapshot(context.Context, *Empty) (*SnapshotInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Snapshot not implemented")
+}
+func (UnimplementedAuctionAdminServer) StepDown(context.Context, *Empty) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StepDown not implemented")
+}
+func (UnimplementedAuctionAdminServer) Drain(context.Context, *DrainRequest) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Drain not implemented")
+}
+func (UnimplementedAuctionAdminServer) VerifyLedger(context.Context, *Empty) (*LedgerReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyLedger not implemented")
+}
+func (UnimplementedAuctionAdminServer) mustEmbedUnimplementedAuctionAdminServer() {}
+func (UnimplementedAuctionAdminServer) testEmbeddedByValue()                      {}
+
+// UnsafeAuctionAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AuctionAdminServer will
+// result in compilation errors.
+type UnsafeAuctionAdminServer interface {
+	mustEmbedUnimplementedAuctionAdminServer()
+}
+
+func RegisterAuctionAdminServer(s grpc.ServiceRegistrar, srv AuctionAdminServer) {
+	// If the following call pancis, it indicates UnimplementedAuctionAdminServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AuctionAdmin_ServiceDesc, srv)
+}
+
+func _AuctionAdmin_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionAdmin_Status_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).Status(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_Snapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).Snapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionAdmin_Snapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).Snapshot(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_StepDown_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).StepDown(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionAdmin_StepDown_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).StepDown(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_Drain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).Drain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionAdmin_Drain_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).Drain(ctx, req.(*DrainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_VerifyLedger_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).VerifyLedger(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuctionAdmin_VerifyLedger_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).VerifyLedger(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AuctionAdmin_ServiceDesc is the grpc.ServiceDesc for AuctionAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AuctionAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.AuctionAdmin",
+	HandlerType: (*AuctionAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Status",
+			Handler:    _AuctionAdmin_Status_Handler,
+		},
+		{
+			MethodName: "Snapshot",
+			Handler:    _AuctionAdmin_Snapshot_Handler,
+		},
+		{
+			MethodName: "StepDown",
+			Handler:    _AuctionAdmin_StepDown_Handler,
+		},
+		{
+			MethodName: "Drain",
+			Handler:    _AuctionAdmin_Drain_Handler,
+		},
+		{
+			MethodName: "VerifyLedger",
+			Handler:    _AuctionAdmin_VerifyLedger_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto.proto",
+}
+
+const (
+	Faults_SetFaults_FullMethodName = "/proto.Faults/SetFaults"
+	Faults_GetFaults_FullMethodName = "/proto.Faults/GetFaults"
+)
+
+// FaultsClient is the client API for Faults service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Faults makes a replica misbehave towards the others, to test replication
+// over a bad network. Servers only offer it when started with fault
+// injection turned on.
+type FaultsClient interface {
+	// SetFaults replaces the replica's rules.
+	SetFaults(ctx context.Context, in *FaultRules, opts ...grpc.CallOption) (*Ack, error)
+	GetFaults(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*FaultRules, error)
+}
+
+type faultsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFaultsClient(cc grpc.ClientConnInterface) FaultsClient {
+	return &faultsClient{cc}
+}
+
+func (c *faultsClient) SetFaults(ctx context.Context, in *FaultRules, opts ...grpc.CallOption) (*Ack, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, Faults_SetFaults_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *faultsClient) GetFaults(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*FaultRules, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FaultRules)
+	err := c.cc.Invoke(ctx, Faults_GetFaults_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FaultsServer is the server API for Faults service.
+// All implementations must embed UnimplementedFaultsServer
+// for forward compatibility.
+//
+// Faults makes a replica misbehave towards the others, to test replication
+// over a bad network. Servers only offer it when started with fault
+// injection turned on.
+type FaultsServer interface {
+	// SetFaults replaces the replica's rules.
+	SetFaults(context.Context, *FaultRules) (*Ack, error)
+	GetFaults(context.Context, *Empty) (*FaultRules, error)
+	mustEmbedUnimplementedFaultsServer()
+}
+
+// UnimplementedFaultsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFaultsServer struct{}
+
+func (UnimplementedFaultsServer) SetFaults(context.Context, *FaultRules) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetFaults not implemented")
+}
+func (UnimplementedFaultsServer) GetFaults(context.Context, *Empty) (*FaultRules, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFaults not implemented")
+}
+func (UnimplementedFaultsServer) mustEmbedUnimplementedFaultsServer() {}
+func (UnimplementedFaultsServer) testEmbeddedByValue()                {}
+
+// UnsafeFaultsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FaultsServer will
+// result in compilation errors.
+type UnsafeFaultsServer interface {
+	mustEmbedUnimplementedFaultsServer()
+}
+
+func RegisterFaultsServer(s grpc.ServiceRegistrar, srv FaultsServer) {
+	// If the following call pancis, it indicates UnimplementedFaultsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Faults_ServiceDesc, srv)
+}
+
+func _Faults_SetFaults_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FaultRules)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FaultsServer).SetFaults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Faults_SetFaults_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FaultsServer).SetFaults(ctx, req.(*FaultRules))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Faults_GetFaults_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FaultsServer).GetFaults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Faults_GetFaults_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FaultsServer).GetFaults(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Faults_ServiceDesc is the grpc.ServiceDesc for Faults service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Faults_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Faults",
+	HandlerType: (*FaultsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetFaults",
+			Handler:    _Faults_SetFaults_Handler,
+		},
+		{
+			MethodName: "GetFaults",
+			Handler:    _Faults_GetFaults_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto.proto",
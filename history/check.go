@@ -0,0 +1,246 @@
+package history
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operation is an invocation matched with its completion. Operations that
+// never completed, or completed with an error, end at math.MaxInt64: they
+// may take effect at any point after they started, or not at all.
+type Operation struct {
+	ID     int64
+	Input  Input
+	Output Output
+	Call   int64
+	Return int64
+	Failed bool
+}
+
+// Operations pairs up the invoke and complete events of a history.
+func Operations(events []Event) ([]Operation, error) {
+	byID := make(map[int64]*Operation)
+	var ops []*Operation
+	for _, e := range events {
+		switch e.Kind {
+		case "invoke":
+			if e.Input == nil {
+				return nil, fmt.Errorf("invoke %d has no input", e.ID)
+			}
+			op := &Operation{ID: e.ID, Input: *e.Input, Call: e.Time, Return: math.MaxInt64, Failed: true}
+			byID[e.ID] = op
+			ops = append(ops, op)
+		case "complete":
+			op, ok := byID[e.ID]
+			if !ok {
+				return nil, fmt.Errorf("complete %d has no invoke", e.ID)
+			}
+			if e.Output != nil && e.Output.Error == "" {
+				op.Output = *e.Output
+				op.Return = e.Time
+				op.Failed = false
+			}
+		default:
+			return nil, fmt.Errorf("event %d has unknown kind %q", e.ID, e.Kind)
+		}
+	}
+	result := make([]Operation, len(ops))
+	for i, op := range ops {
+		result[i] = *op
+	}
+	return result, nil
+}
+
+// Model describes the object the history is checked against. States must be
+// comparable values.
+type Model struct {
+	Init func() any
+	// Step returns the states op can lead to from state, and none if op
+	// could not have returned its output in that state.
+	Step func(state any, op Operation) []any
+	// Partition splits a history into parts that can be checked on their
+	// own, e.g. one per auction. It may be nil.
+	Partition func(ops []Operation) map[string][]Operation
+}
+
+// Result tells whether each part of a history is linearizable. Parts that
+// could not be decided in time are in Undecided instead of Parts, and keep
+// Linearizable false.
+type Result struct {
+	Linearizable bool
+	Parts        map[string]bool
+	Undecided    []string
+}
+
+// Check reports whether the operations could have happened one at a time,
+// each somewhere between its call and return, on the object described by
+// model. It is the algorithm of Wing & Gong with the memoisation of Lowe,
+// as used by Porcupine.
+func Check(model Model, ops []Operation) Result {
+	return CheckTimeout(model, ops, 0)
+}
+
+// CheckTimeout is Check, but gives up on a part after timeout, or never if
+// timeout is 0. The search can take exponential time in the number of
+// failed operations, since each of them may or may not have taken effect.
+func CheckTimeout(model Model, ops []Operation, timeout time.Duration) Result {
+	parts := map[string][]Operation{"": ops}
+	if model.Partition != nil {
+		parts = model.Partition(ops)
+	}
+	result := Result{Linearizable: true, Parts: make(map[string]bool)}
+	for name, part := range parts {
+		var deadline time.Time
+		if timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+		ok, decided := checkPart(model, part, deadline)
+		if !decided {
+			result.Undecided = append(result.Undecided, name)
+			result.Linearizable = false
+			continue
+		}
+		result.Parts[name] = ok
+		result.Linearizable = result.Linearizable && ok
+	}
+	sort.Strings(result.Undecided)
+	return result
+}
+
+type entry struct {
+	op         int
+	isCall     bool
+	time       int64
+	match      *entry // the return of a call
+	prev, next *entry
+}
+
+func (e *entry) lift() {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	m := e.match
+	m.prev.next = m.next
+	if m.next != nil {
+		m.next.prev = m.prev
+	}
+}
+
+func (e *entry) unlift() {
+	m := e.match
+	m.prev.next = m
+	if m.next != nil {
+		m.next.prev = m
+	}
+	e.prev.next = e
+	e.next.prev = e
+}
+
+// checkPart reports whether ops are linearizable, and whether it found out
+// before the deadline. A zero deadline never passes.
+func checkPart(model Model, ops []Operation, deadline time.Time) (ok, decided bool) {
+	var entries []*entry
+	for i, op := range ops {
+		call := &entry{op: i, isCall: true, time: op.Call}
+		ret := &entry{op: i, time: op.Return}
+		call.match = ret
+		entries = append(entries, call, ret)
+	}
+	// at equal times calls go first, so touching operations count as
+	// concurrent
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].time != entries[j].time {
+			return entries[i].time < entries[j].time
+		}
+		return entries[i].isCall && !entries[j].isCall
+	})
+	head := &entry{}
+	prev := head
+	for _, e := range entries {
+		prev.next = e
+		e.prev = prev
+		prev = e
+	}
+
+	type frame struct {
+		call   *entry
+		states []any
+	}
+	var stack []frame
+	linearized := make([]bool, len(ops))
+	seen := make(map[string]bool)
+	states := []any{model.Init()}
+
+	e := head.next
+	for steps := 0; head.next != nil; steps++ {
+		if steps%1024 == 0 && !deadline.IsZero() && time.Now().After(deadline) {
+			return false, false
+		}
+		if e.isCall {
+			next := stepAll(model, states, ops[e.op])
+			if len(next) > 0 {
+				linearized[e.op] = true
+				key := cacheKey(linearized, next)
+				if !seen[key] {
+					seen[key] = true
+					stack = append(stack, frame{call: e, states: states})
+					states = next
+					e.lift()
+					e = head.next
+					continue
+				}
+				linearized[e.op] = false
+			}
+			e = e.next
+			continue
+		}
+
+		// an operation returned before we found a place for it, so undo
+		// the last choice and try the next one
+		if len(stack) == 0 {
+			return false, true
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		states = top.states
+		linearized[top.call.op] = false
+		top.call.unlift()
+		e = top.call.next
+	}
+	return true, true
+}
+
+// stepAll applies op to every state the object could be in.
+func stepAll(model Model, states []any, op Operation) []any {
+	var next []any
+	seen := make(map[any]bool)
+	for _, s := range states {
+		for _, n := range model.Step(s, op) {
+			if !seen[n] {
+				seen[n] = true
+				next = append(next, n)
+			}
+		}
+	}
+	return next
+}
+
+func cacheKey(linearized []bool, states []any) string {
+	var b strings.Builder
+	for _, l := range linearized {
+		if l {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	keys := make([]string, len(states))
+	for i, s := range states {
+		keys[i] = fmt.Sprintf("%#v", s)
+	}
+	sort.Strings(keys)
+	b.WriteString(strings.Join(keys, "|"))
+	return b.String()
+}
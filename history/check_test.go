@@ -0,0 +1,111 @@
+package history
+
+import "testing"
+
+func bid(id, call, ret int64, bidder string, amount int64, ack string) Operation {
+	return Operation{
+		ID:     id,
+		Input:  Input{Op: OpBid, Auction: "default", Bidder: bidder, Amount: amount},
+		Output: Output{Ack: ack},
+		Call:   call,
+		Return: ret,
+	}
+}
+
+func result(id, call, ret int64, bidder string, amount int64) Operation {
+	return Operation{
+		ID:     id,
+		Input:  Input{Op: OpResult, Auction: "default"},
+		Output: Output{HighestBidder: bidder, HighestBid: amount},
+		Call:   call,
+		Return: ret,
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []Operation
+		want bool
+	}{
+		{
+			name: "sequential",
+			ops: []Operation{
+				bid(1, 0, 10, "Anna", 100, AckSuccess),
+				bid(2, 20, 30, "Karoline", 100, "BidException: Your bid was too low ;("),
+				result(3, 40, 50, "Anna", 100),
+			},
+			want: true,
+		},
+		{
+			// either order of two concurrent equal bids is fine, as long
+			// as the result agrees with the one that won
+			name: "concurrent equal bids",
+			ops: []Operation{
+				bid(1, 0, 30, "Anna", 100, "BidException: Your bid was too low ;("),
+				bid(2, 10, 20, "Karoline", 100, AckSuccess),
+				result(3, 40, 50, "Karoline", 100),
+			},
+			want: true,
+		},
+		{
+			name: "both equal bids accepted",
+			ops: []Operation{
+				bid(1, 0, 30, "Anna", 100, AckSuccess),
+				bid(2, 10, 20, "Karoline", 100, AckSuccess),
+			},
+			want: false,
+		},
+		{
+			// a replica answering from behind the leader
+			name: "stale read",
+			ops: []Operation{
+				bid(1, 0, 10, "Anna", 100, AckSuccess),
+				result(2, 20, 30, "", 0),
+			},
+			want: false,
+		},
+		{
+			name: "failed bid that took effect",
+			ops: []Operation{
+				{ID: 1, Input: Input{Op: OpBid, Auction: "default", Bidder: "Anna", Amount: 100}, Call: 0, Return: 1 << 62, Failed: true},
+				result(2, 20, 30, "Anna", 100),
+			},
+			want: true,
+		},
+		{
+			name: "failed bid that did not take effect",
+			ops: []Operation{
+				{ID: 1, Input: Input{Op: OpBid, Auction: "default", Bidder: "Anna", Amount: 100}, Call: 0, Return: 1 << 62, Failed: true},
+				result(2, 20, 30, "", 0),
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Check(AuctionModel, tt.ops).Linearizable; got != tt.want {
+				t.Fatalf("linearizable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperationsFromRecorder(t *testing.T) {
+	r := NewRecorder()
+	a := r.Invoke(Input{Op: OpBid, Auction: "default", Bidder: "Anna", Amount: 5})
+	b := r.Invoke(Input{Op: OpResult, Auction: "default"})
+	r.Complete(a, Output{Ack: AckSuccess})
+	r.Complete(b, Output{Error: "unavailable"})
+
+	ops, err := Operations(r.Events())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 || ops[0].Failed || !ops[1].Failed {
+		t.Fatalf("got %+v, want a completed bid and a failed result", ops)
+	}
+	if !Check(AuctionModel, ops).Linearizable {
+		t.Fatal("history is not linearizable")
+	}
+}
@@ -0,0 +1,120 @@
+// Package history records what clients asked the auction and what they got
+// back, and checks whether the answers could have come from a single,
+// unreplicated auction.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Operation names.
+const (
+	OpBid    = "bid"
+	OpResult = "result"
+)
+
+// Input is what a client asked for.
+type Input struct {
+	Op      string `json:"op"`
+	Auction string `json:"auction"`
+	Bidder  string `json:"bidder,omitempty"`
+	Amount  int64  `json:"amount,omitempty"`
+}
+
+// Output is what a client got back. Error is set if the call failed, in
+// which case the operation may or may not have taken effect.
+type Output struct {
+	Ack           string `json:"ack,omitempty"`
+	HighestBidder string `json:"highestBidder,omitempty"`
+	HighestBid    int64  `json:"highestBid,omitempty"`
+	Over          bool   `json:"over,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Event is one line of a recorded history: either the invocation of an
+// operation or its completion, matched by ID.
+type Event struct {
+	Kind   string  `json:"kind"` // "invoke" or "complete"
+	ID     int64   `json:"id"`
+	Time   int64   `json:"time"` // unix nanoseconds
+	Input  *Input  `json:"input,omitempty"`
+	Output *Output `json:"output,omitempty"`
+}
+
+// Recorder collects events from any number of goroutines.
+type Recorder struct {
+	mutex  sync.Mutex
+	nextID int64
+	events []Event
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Invoke records the start of an operation and returns its ID.
+func (r *Recorder) Invoke(in Input) int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.nextID++
+	r.events = append(r.events, Event{Kind: "invoke", ID: r.nextID, Time: time.Now().UnixNano(), Input: &in})
+	return r.nextID
+}
+
+// Complete records the end of the operation with the given ID.
+func (r *Recorder) Complete(id int64, out Output) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, Event{Kind: "complete", ID: id, Time: time.Now().UnixNano(), Output: &out})
+}
+
+// Events returns a copy of everything recorded so far.
+func (r *Recorder) Events() []Event {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// Save writes the history as JSON Lines.
+func (r *Recorder) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range r.Events() {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads a history written by Save.
+func Load(r io.Reader) ([]Event, error) {
+	var events []Event
+	dec := json.NewDecoder(r)
+	for {
+		var e Event
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", len(events)+1, err)
+		}
+		events = append(events, e)
+	}
+}
@@ -0,0 +1,56 @@
+package history
+
+// auctionState is what a single, unreplicated auction would hold.
+type auctionState struct {
+	highestBidder string
+	highestBid    int64
+}
+
+// Acks the servers answer bids with.
+const (
+	AckSuccess = "success"
+	AckFail    = "fail"
+)
+
+// AuctionModel checks each auction of a history on its own. A bid succeeds
+// only if it is higher than every bid before it, and a result shows the
+// highest bid so far. Closing is not part of the model, so histories should
+// not span the end of an auction.
+var AuctionModel = Model{
+	Init: func() any { return auctionState{} },
+	Step: func(state any, op Operation) []any {
+		s := state.(auctionState)
+		switch op.Input.Op {
+		case OpBid:
+			higher := op.Input.Amount > s.highestBid
+			after := s
+			if higher {
+				after = auctionState{highestBidder: op.Input.Bidder, highestBid: op.Input.Amount}
+			}
+			if op.Failed {
+				// we don't know if the bid got through
+				return []any{s, after}
+			}
+			if higher != (op.Output.Ack == AckSuccess) {
+				return nil
+			}
+			return []any{after}
+		case OpResult:
+			if op.Failed {
+				return []any{s}
+			}
+			if op.Output.HighestBidder != s.highestBidder || op.Output.HighestBid != s.highestBid {
+				return nil
+			}
+			return []any{s}
+		}
+		return nil
+	},
+	Partition: func(ops []Operation) map[string][]Operation {
+		parts := make(map[string][]Operation)
+		for _, op := range ops {
+			parts[op.Input.Auction] = append(parts[op.Input.Auction], op)
+		}
+		return parts
+	},
+}
@@ -0,0 +1,244 @@
+// Package launcher runs a cluster of server processes on this machine, for
+// the simulation and other tools that need real replicas to crash.
+package launcher
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Build compiles the server into dir and returns the path of the binary. It
+// has to run inside the module.
+func Build(dir string) (string, error) {
+	bin := filepath.Join(dir, "server")
+	out, err := exec.Command("go", "build", "-o", bin, "Replication/server").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("build server: %v\n%s", err, out)
+	}
+	return bin, nil
+}
+
+// Cluster is a set of server processes that know each other.
+type Cluster struct {
+	Binary string
+	Dir    string   // each node runs in a directory of its own below Dir, where its output is kept in output.log
+	Args   []string // extra flags for every server
+	Addrs  []string
+	Output io.Writer // receives the nodes' output, each line prefixed with the node's name
+
+	mutex sync.Mutex
+	nodes []*node
+}
+
+type node struct {
+	cmd  *exec.Cmd
+	done chan struct{} // closed once the process has exited
+}
+
+// New describes a cluster of n servers listening on basePort and the ports
+// after it. Nothing runs until Start is called.
+func New(binary, dir string, n, basePort int, args ...string) *Cluster {
+	var addrs []string
+	for i := 0; i < n; i++ {
+		addrs = append(addrs, fmt.Sprintf(":%d", basePort+i))
+	}
+	return WithAddrs(binary, dir, addrs, args...)
+}
+
+// WithAddrs describes a cluster of servers listening on addrs, like the
+// servers' -cluster flag lists them.
+func WithAddrs(binary, dir string, addrs []string, args ...string) *Cluster {
+	return &Cluster{Binary: binary, Dir: dir, Args: args, Addrs: addrs, Output: os.Stdout, nodes: make([]*node, len(addrs))}
+}
+
+// Name is how node i is called in logs.
+func (c *Cluster) Name(i int) string {
+	return fmt.Sprintf("node%d", i)
+}
+
+// StartAll starts every node that is not running.
+func (c *Cluster) StartAll() error {
+	for i := range c.Addrs {
+		if c.Running(i) {
+			continue
+		}
+		if err := c.Start(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start starts node i.
+func (c *Cluster) Start(i int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if n := c.nodes[i]; n != nil && !exited(n) {
+		return fmt.Errorf("%s is already running", c.Name(i))
+	}
+
+	dir := filepath.Join(c.Dir, c.Name(i))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	_, port, err := net.SplitHostPort(c.Addrs[i])
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.Name(i), err)
+	}
+	args := append([]string{
+		"-port", port,
+		"-cluster", strings.Join(c.Addrs, ","),
+	}, c.Args...)
+	cmd := exec.Command(c.Binary, args...)
+	cmd.Dir = dir
+
+	logFile, err := os.OpenFile(filepath.Join(dir, "output.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		logFile.Close()
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return fmt.Errorf("start %s: %w", c.Name(i), err)
+	}
+
+	n := &node{cmd: cmd, done: make(chan struct{})}
+	c.nodes[i] = n
+	go func() {
+		c.copyLines(c.Name(i), io.TeeReader(out, logFile))
+		logFile.Close()
+		err := cmd.Wait()
+		c.mutex.Lock()
+		fmt.Fprintf(c.Output, "[%s] exited: %v\n", c.Name(i), exitStatus(err))
+		c.mutex.Unlock()
+		close(n.done)
+	}()
+	return nil
+}
+
+// copyLines writes the node's output line by line, so lines of different
+// nodes do not mix. If it cannot go on, it still reads the rest, or the node
+// would block once the pipe is full.
+func (c *Cluster) copyLines(name string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		c.mutex.Lock()
+		fmt.Fprintf(c.Output, "[%s] %s\n", name, scanner.Text())
+		c.mutex.Unlock()
+	}
+	if err := scanner.Err(); err != nil {
+		c.mutex.Lock()
+		fmt.Fprintf(c.Output, "[%s] stopped showing output: %v\n", name, err)
+		c.mutex.Unlock()
+	}
+	io.Copy(io.Discard, r)
+}
+
+func exitStatus(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return err.Error()
+}
+
+func exited(n *node) bool {
+	select {
+	case <-n.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Running reports whether node i has been started and not exited since.
+func (c *Cluster) Running(i int) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	n := c.nodes[i]
+	return n != nil && !exited(n)
+}
+
+// Stop asks node i to shut down with SIGTERM, and kills it if it has not
+// exited after timeout.
+func (c *Cluster) Stop(i int, timeout time.Duration) error {
+	if err := c.signal(i, syscall.SIGTERM); err != nil {
+		return err
+	}
+	if c.wait(i, timeout) {
+		return nil
+	}
+	return c.Kill(i)
+}
+
+// Kill ends node i with SIGKILL, like a crash, and waits for it to exit.
+func (c *Cluster) Kill(i int) error {
+	if err := c.signal(i, syscall.SIGKILL); err != nil {
+		return err
+	}
+	c.wait(i, time.Minute)
+	return nil
+}
+
+// Restart kills node i if it runs and starts it again.
+func (c *Cluster) Restart(i int) error {
+	if c.Running(i) {
+		if err := c.Kill(i); err != nil {
+			return err
+		}
+	}
+	return c.Start(i)
+}
+
+// StopAll stops every running node.
+func (c *Cluster) StopAll(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for i := range c.Addrs {
+		if !c.Running(i) {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Stop(i, timeout)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) signal(i int, sig syscall.Signal) error {
+	c.mutex.Lock()
+	n := c.nodes[i]
+	c.mutex.Unlock()
+	if n == nil || exited(n) {
+		return fmt.Errorf("%s is not running", c.Name(i))
+	}
+	return n.cmd.Process.Signal(sig)
+}
+
+// wait reports whether node i exited within timeout.
+func (c *Cluster) wait(i int, timeout time.Duration) bool {
+	c.mutex.Lock()
+	n := c.nodes[i]
+	c.mutex.Unlock()
+	select {
+	case <-n.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
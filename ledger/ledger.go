@@ -0,0 +1,272 @@
+// Package ledger writes, reads and checks audit trails of bids. The records
+// of a trail form a hash chain: each one holds the hash of the record before
+// it, and its own hash covers that and all its fields, so changing, dropping
+// or reordering a record breaks the chain from there on. The servers' logs
+// are chained the same way, see EntryHash.
+package ledger
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	proto "Replication/grpc"
+
+	gproto "google.golang.org/protobuf/proto"
+)
+
+// Record is one bid in an audit trail.
+type Record struct {
+	Index     int64     `json:"index"` // of the log entry the bid came from
+	Time      time.Time `json:"time"`  // when the leader put the bid in its log
+	Replica   string    `json:"replica"`
+	Auction   string    `json:"auction"`
+	Bidder    string    `json:"bidder"`
+	Amount    int64     `json:"amount"` // in minor units of Currency
+	Currency  string    `json:"currency"`
+	Timestamp int32     `json:"timestamp"` // the bidder's Lamport time
+	Accepted  bool      `json:"accepted"`
+	Reason    string    `json:"reason"`
+	PrevHash  string    `json:"prevHash"`
+	Hash      string    `json:"hash"`
+}
+
+// FromProto converts a record as the servers send it.
+func FromProto(r *proto.AuditRecord) Record {
+	return Record{
+		Index:     r.Index,
+		Time:      time.Unix(0, r.Time).UTC(),
+		Replica:   r.Replica,
+		Auction:   r.Auction,
+		Bidder:    r.Bidder,
+		Amount:    r.Amount,
+		Currency:  r.Currency,
+		Timestamp: r.Timestamp,
+		Accepted:  r.Accepted,
+		Reason:    r.Reason,
+		PrevHash:  r.PrevHash,
+		Hash:      r.Hash,
+	}
+}
+
+// Proto converts the record for sending.
+func (r Record) Proto() *proto.AuditRecord {
+	return &proto.AuditRecord{
+		Index:     r.Index,
+		Time:      r.Time.UnixNano(),
+		Replica:   r.Replica,
+		Auction:   r.Auction,
+		Bidder:    r.Bidder,
+		Amount:    r.Amount,
+		Currency:  r.Currency,
+		Timestamp: r.Timestamp,
+		Accepted:  r.Accepted,
+		Reason:    r.Reason,
+		PrevHash:  r.PrevHash,
+		Hash:      r.Hash,
+	}
+}
+
+// Sum returns the hex SHA-256 of the record's fields, PrevHash included and
+// Hash left out.
+func Sum(r Record) string {
+	fields := []string{
+		r.PrevHash,
+		strconv.FormatInt(r.Index, 10),
+		strconv.FormatInt(r.Time.UnixNano(), 10),
+		r.Replica,
+		r.Auction,
+		r.Bidder,
+		strconv.FormatInt(r.Amount, 10),
+		r.Currency,
+		strconv.FormatInt(int64(r.Timestamp), 10),
+		strconv.FormatBool(r.Accepted),
+		r.Reason,
+	}
+	// quoting keeps a separator inside a field from shifting the others
+	h := sha256.New()
+	for _, f := range fields {
+		io.WriteString(h, strconv.Quote(f)+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// EntryHash returns the hex SHA-256 of a log entry. The entry holds the hash
+// of the one before it, so the hash covers the whole log up to the entry.
+// All replicas have to run the same version for their hashes to agree.
+func EntryHash(e *proto.Entry) string {
+	data, err := gproto.MarshalOptions{Deterministic: true}.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Link adds r to a chain whose last hash is prev, empty for a new chain.
+func Link(prev string, r *Record) {
+	r.PrevHash = prev
+	r.Hash = Sum(*r)
+}
+
+// Verify checks the chain and returns an error naming the first record that
+// does not fit.
+func Verify(records []Record) error {
+	prev := ""
+	for i, r := range records {
+		if r.PrevHash != prev {
+			return fmt.Errorf("record %d (index %d) does not follow the record before it", i+1, r.Index)
+		}
+		if Sum(r) != r.Hash {
+			return fmt.Errorf("record %d (index %d) was changed", i+1, r.Index)
+		}
+		prev = r.Hash
+	}
+	return nil
+}
+
+// Diverge returns the position of the first record where the two trails
+// have different hashes, or -1 if the shorter one is a prefix of the longer.
+func Diverge(a, b []Record) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].Hash != b[i].Hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// Anchor checks records against the trail the servers have now. Verify
+// alone cannot catch someone who edits a trail and hashes it again, but the
+// servers' chain goes on from the true hashes, so the edited records no
+// longer match it.
+func Anchor(records, live []Record) error {
+	if i := Diverge(records, live); i >= 0 {
+		return fmt.Errorf("record %d (index %d) differs from the servers' trail", i+1, records[i].Index)
+	}
+	if len(records) > len(live) {
+		return fmt.Errorf("has %d records, the servers only %d", len(records), len(live))
+	}
+	return nil
+}
+
+var header = []string{"index", "time", "replica", "auction", "bidder", "amount", "currency", "timestamp", "accepted", "reason", "prevHash", "hash"}
+
+// WriteCSV writes the records with a header line.
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, r := range records {
+		cw.Write([]string{
+			strconv.FormatInt(r.Index, 10),
+			r.Time.Format(time.RFC3339Nano),
+			r.Replica,
+			r.Auction,
+			r.Bidder,
+			strconv.FormatInt(r.Amount, 10),
+			r.Currency,
+			strconv.FormatInt(int64(r.Timestamp), 10),
+			strconv.FormatBool(r.Accepted),
+			r.Reason,
+			r.PrevHash,
+			r.Hash,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSONLines writes one JSON object per record and line.
+func WriteJSONLines(w io.Writer, records []Record) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read reads records written by WriteCSV or WriteJSONLines, telling them
+// apart by the first character.
+func Read(r io.Reader) ([]Record, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(1)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if first[0] == '{' {
+		return readJSONLines(br)
+	}
+	return readCSV(br)
+}
+
+func readJSONLines(r io.Reader) ([]Record, error) {
+	var records []Record
+	dec := json.NewDecoder(r)
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(header, ",") {
+		return nil, fmt.Errorf("the first line is not the header %s", strings.Join(header, ","))
+	}
+	var records []Record
+	for i, row := range rows[1:] {
+		rec, err := parseRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func parseRow(row []string) (Record, error) {
+	var rec Record
+	var err error
+	if rec.Index, err = strconv.ParseInt(row[0], 10, 64); err != nil {
+		return rec, err
+	}
+	if rec.Time, err = time.Parse(time.RFC3339Nano, row[1]); err != nil {
+		return rec, err
+	}
+	if rec.Amount, err = strconv.ParseInt(row[5], 10, 64); err != nil {
+		return rec, err
+	}
+	timestamp, err := strconv.ParseInt(row[7], 10, 32)
+	if err != nil {
+		return rec, err
+	}
+	if rec.Accepted, err = strconv.ParseBool(row[8]); err != nil {
+		return rec, err
+	}
+	rec.Replica, rec.Auction, rec.Bidder, rec.Currency = row[2], row[3], row[4], row[6]
+	rec.Timestamp = int32(timestamp)
+	rec.Reason, rec.PrevHash, rec.Hash = row[9], row[10], row[11]
+	return rec, nil
+}
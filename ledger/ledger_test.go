@@ -0,0 +1,124 @@
+package ledger
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func trail() []Record {
+	start := time.Date(2024, 11, 1, 12, 0, 0, 123456789, time.UTC)
+	records := []Record{
+		{Index: 3, Replica: ":50051", Bidder: "anna", Amount: 10, Timestamp: 1, Reason: "accepted", Accepted: true},
+		{Index: 5, Replica: ":50052", Bidder: "bo", Amount: 8, Timestamp: 2, Reason: "too_low"},
+		{Index: 9, Replica: ":50053", Bidder: "bo, \"the second\"", Amount: 12, Timestamp: 4, Reason: "closed"},
+	}
+	prev := ""
+	for i := range records {
+		records[i].Auction, records[i].Currency = "spring", "DKK"
+		records[i].Time = start.Add(time.Duration(i) * time.Second)
+		Link(prev, &records[i])
+		prev = records[i].Hash
+	}
+	return records
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+	records := trail()
+	for name, write := range map[string]func(*bytes.Buffer, []Record) error{
+		"csv":   func(b *bytes.Buffer, r []Record) error { return WriteCSV(b, r) },
+		"jsonl": func(b *bytes.Buffer, r []Record) error { return WriteJSONLines(b, r) },
+	} {
+		var buf bytes.Buffer
+		if err := write(&buf, records); err != nil {
+			t.Fatalf("%s: write: %v", name, err)
+		}
+		got, err := Read(&buf)
+		if err != nil {
+			t.Fatalf("%s: read: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, records) {
+			t.Errorf("%s: got %+v, want %+v", name, got, records)
+		}
+		if err := Verify(got); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestVerifyFindsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func([]Record) []Record
+		want   string
+	}{
+		{"changed amount", func(r []Record) []Record { r[1].Amount = 11; return r }, "record 2 (index 5) was changed"},
+		{"dropped record", func(r []Record) []Record { return append(r[:1], r[2:]...) }, "record 2 (index 9) does not follow"},
+		{"swapped records", func(r []Record) []Record { r[0], r[1] = r[1], r[0]; return r }, "record 1 (index 5) does not follow"},
+		{"rehashed record", func(r []Record) []Record { r[0].Reason = "too_low"; Link("", &r[0]); return r }, "record 2 (index 5) does not follow"},
+	}
+	for _, tt := range tests {
+		err := Verify(tt.change(trail()))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDiverge(t *testing.T) {
+	changed := trail()
+	changed[1].Reason = "accepted"
+	Link(changed[0].Hash, &changed[1])
+	tests := []struct {
+		name string
+		a, b []Record
+		want int
+	}{
+		{"same", trail(), trail(), -1},
+		{"prefix", trail()[:2], trail(), -1},
+		{"empty", nil, trail(), -1},
+		{"changed", trail(), changed, 1},
+		{"changed in the shorter", changed[:2], trail(), 1},
+	}
+	for _, tt := range tests {
+		if got := Diverge(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRehashedTrailIsCaught(t *testing.T) {
+	live := trail()
+	edited := trail()
+	edited[1].Reason, edited[1].Accepted = "accepted", true
+	for i := 1; i < len(edited); i++ {
+		Link(edited[i-1].Hash, &edited[i])
+	}
+	if err := Verify(edited); err != nil {
+		t.Fatalf("the rehashed chain should hold together: %v", err)
+	}
+	if err := Anchor(edited, live); err == nil || !strings.Contains(err.Error(), "record 2") {
+		t.Errorf("rehashed trail: got %v", err)
+	}
+	if err := Anchor(live[:2], live); err != nil {
+		t.Errorf("older export: %v", err)
+	}
+	if err := Anchor(live, live[:2]); err == nil {
+		t.Error("a trail longer than the servers' passed")
+	}
+}
+
+func TestEditedCSVIsCaught(t *testing.T) {
+	var buf bytes.Buffer
+	WriteCSV(&buf, trail())
+	edited := strings.Replace(buf.String(), ",too_low,", ",accepted,", 1)
+	records, err := Read(strings.NewReader(edited))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := Verify(records); err == nil || !strings.Contains(err.Error(), "record 2") {
+		t.Errorf("edited reason: got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+// Package money formats and parses amounts of money. Amounts are whole
+// numbers of a currency's minor unit, like cents, so they add up without
+// rounding, and every auction has an ISO 4217 currency code that says how
+// many digits of an amount come after the decimal point.
+package money
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// digits maps the currencies the auctions take to their number of decimal
+// places, as ISO 4217 lists them.
+var digits = map[string]int{
+	"AED": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CLP": 0,
+	"CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2,
+	"IDR": 2, "ILS": 2, "INR": 2, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+	"KWD": 3, "MXN": 2, "NOK": 2, "NZD": 2, "OMR": 3, "PLN": 2, "RON": 2,
+	"SAR": 2, "SEK": 2, "SGD": 2, "THB": 2, "TND": 3, "TRY": 2, "TWD": 2,
+	"UAH": 2, "USD": 2, "VND": 0, "ZAR": 2,
+}
+
+// Valid reports whether code is a currency the auctions take.
+func Valid(code string) bool {
+	_, ok := digits[code]
+	return ok
+}
+
+// Digits returns the number of decimal places of the currency, 2 for
+// currencies it does not know.
+func Digits(code string) int {
+	if d, ok := digits[code]; ok {
+		return d
+	}
+	return 2
+}
+
+// Format writes an amount in minor units with its decimal places and the
+// currency code, like 1250 DKK as "12.50 DKK".
+func Format(amount int64, code string) string {
+	text := strconv.FormatInt(amount, 10)
+	sign := ""
+	if amount < 0 {
+		sign, text = "-", text[1:]
+	}
+	if d := Digits(code); d > 0 {
+		if len(text) <= d {
+			text = strings.Repeat("0", d-len(text)+1) + text
+		}
+		text = text[:len(text)-d] + "." + text[len(text)-d:]
+	}
+	if code == "" {
+		return sign + text
+	}
+	return sign + text + " " + code
+}
+
+// Parse reads an amount like "12.5" or "12.50" in the currency and returns
+// it in minor units. It refuses more decimal places than the currency has.
+func Parse(s, code string) (int64, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	d := Digits(code)
+	if len(frac) > d || (hasFrac && frac == "") {
+		return 0, fmt.Errorf("%q: %s takes %d decimal places", s, code, d)
+	}
+	frac += strings.Repeat("0", d-len(frac))
+	if whole == "" || whole == "-" || whole == "+" {
+		whole += "0"
+	}
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an amount", s)
+	}
+	return amount, nil
+}
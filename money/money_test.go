@@ -0,0 +1,51 @@
+package money
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount int64
+		code   string
+		want   string
+	}{
+		{1250, "DKK", "12.50 DKK"},
+		{5, "EUR", "0.05 EUR"},
+		{-5, "EUR", "-0.05 EUR"},
+		{1500, "JPY", "1500 JPY"},
+		{1234, "KWD", "1.234 KWD"},
+		{9223372036854775807, "USD", "92233720368547758.07 USD"},
+		{700, "", "7.00"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.amount, tt.code); got != tt.want {
+			t.Errorf("Format(%d, %q) = %q, want %q", tt.amount, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		code string
+		want int64
+		ok   bool
+	}{
+		{"12.50", "DKK", 1250, true},
+		{"12.5", "DKK", 1250, true},
+		{"12", "DKK", 1200, true},
+		{".5", "EUR", 50, true},
+		{"1500", "JPY", 1500, true},
+		{"1.234", "KWD", 1234, true},
+		{"12.505", "DKK", 0, false},
+		{"12.", "DKK", 0, false},
+		{"15.5", "JPY", 0, false},
+		{"ten", "DKK", 0, false},
+		{"99999999999999999999", "DKK", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.text, tt.code)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("Parse(%q, %q) = %d, %v", tt.text, tt.code, got, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/metadata"
+)
+
+// Roles a bearer token can carry.
+const (
+	RoleBidder     = "bidder"
+	RoleAuctioneer = "auctioneer"
+	RoleReplica    = "replica"
+	RoleAdmin      = "admin"
+)
+
+// Claims are the contents of a bearer token. The subject is the bidder name
+// for bidders and the node address for replicas.
+type Claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Signer issues and checks bearer tokens signed with a key shared by all
+// replicas.
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// LoadSigner reads the key from a file, as written by tokengen -new-key.
+func LoadSigner(path string) (*Signer, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read token key: %w", err)
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) < 32 {
+		return nil, fmt.Errorf("token key in %s is shorter than 32 bytes", path)
+	}
+	return NewSigner(key), nil
+}
+
+// Issue makes a token for subject with the given role. A validFor of 0 makes
+// a token that does not expire.
+func (s *Signer) Issue(subject, role string, validFor time.Duration) (string, error) {
+	claims := Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  subject,
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if validFor > 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(validFor))
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.key)
+}
+
+// Verify checks the signature and expiry of token and returns its claims.
+func (s *Signer) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return s.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if claims.Role == "" {
+		return nil, errors.New("token has no role")
+	}
+	return claims, nil
+}
+
+// BearerToken attaches a token to every call made on a connection. The token
+// can be swapped, e.g. once a client has registered.
+type BearerToken struct {
+	mutex sync.Mutex
+	token string
+}
+
+func NewBearerToken(token string) *BearerToken {
+	return &BearerToken{token: token}
+}
+
+func (b *BearerToken) Set(token string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.token = token
+}
+
+func (b *BearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.token == "" {
+		return nil, nil
+	}
+	return map[string]string{"authorization": "Bearer " + b.token}, nil
+}
+
+// RequireTransportSecurity is false so tokens also work in a local cluster
+// running without TLS.
+func (b *BearerToken) RequireTransportSecurity() bool {
+	return false
+}
+
+// TokenFromContext returns the bearer token sent with an incoming call.
+func TokenFromContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	for _, value := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+type claimsKey struct{}
+
+// WithClaims stores the caller's verified claims in ctx.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by WithClaims.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
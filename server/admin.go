@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	proto "Replication/grpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+// adminServer exposes the AuctionAdmin service of an AuctionServer.
+type adminServer struct {
+	proto.UnimplementedAuctionAdminServer
+	s *AuctionServer
+}
+
+func (a *adminServer) Status(ctx context.Context, _ *proto.Empty) (*proto.NodeStatus, error) {
+	s := a.s
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	st := &proto.NodeStatus{
+		Id:            s.id,
+		Role:          s.role.String(),
+		Term:          s.term,
+		Leader:        s.leader,
+		CommitIndex:   s.commitIndex,
+		AppliedIndex:  s.lastApplied,
+		LastLogIndex:  s.lastIndex(),
+		SnapshotIndex: s.base(),
+		LamportTime:   s.lamportTime,
+		Auctions:      s.auctionStates(),
+		Recovering:    s.recovering || s.asked != nil,
+		Draining:      s.draining,
+		Serving:       s.serving(),
+	}
+	for _, peer := range s.peers {
+		ps := &proto.PeerStatus{Id: peer}
+		if conn, ok := s.conns[peer]; ok {
+			state := conn.GetState()
+			ps.Connection = strings.ToLower(state.String())
+			ps.Reachable = state == connectivity.Ready
+		}
+		if s.role == leader {
+			ps.Reachable = s.heard[peer] < electionTicks
+			ps.MatchIndex = s.matchIndex[peer]
+			ps.NextIndex = s.nextIndex[peer]
+		}
+		st.Peers = append(st.Peers, ps)
+	}
+	return st, nil
+}
+
+func (a *adminServer) Snapshot(ctx context.Context, _ *proto.Empty) (*proto.SnapshotInfo, error) {
+	s := a.s
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	compacted := s.takeSnapshot()
+	info := &proto.SnapshotInfo{Compacted: compacted}
+	if s.snapshot != nil {
+		info.Index, info.Term = s.snapshot.Index, s.snapshot.Term
+	}
+	return info, nil
+}
+
+func (a *adminServer) StepDown(ctx context.Context, _ *proto.Empty) (*proto.Ack, error) {
+	s := a.s
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.role != leader {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s is not the leader", s.id)
+	}
+	s.stepDown()
+	return &proto.Ack{Ack: "stepped down"}, nil
+}
+
+func (a *adminServer) Drain(ctx context.Context, req *proto.DrainRequest) (*proto.Ack, error) {
+	s := a.s
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if req.Resume {
+		s.draining = false
+		s.logger.Info("resumed")
+		return &proto.Ack{Ack: "resumed"}, nil
+	}
+	s.draining = true
+	s.dropWatchers()
+	if s.role == leader {
+		s.stepDown()
+	}
+	s.logger.Info("draining")
+	return &proto.Ack{Ack: "draining"}, nil
+}
+
+// VerifyLedger reports the first entry that breaks the chain in the
+// replica's own log, or else the first mismatch found while replicating.
+func (a *adminServer) VerifyLedger(ctx context.Context, _ *proto.Empty) (*proto.LedgerReport, error) {
+	s := a.s
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	report := &proto.LedgerReport{FirstIndex: s.base(), LastIndex: s.lastIndex(), HeadHash: s.hashAt(s.lastIndex())}
+	if index, reason := s.verifyChain(); index != 0 {
+		report.MismatchIndex, report.Reason = index, reason
+	} else if s.mismatch != nil {
+		report.MismatchIndex, report.Peer, report.Reason = s.mismatch.MismatchIndex, s.mismatch.Peer, s.mismatch.Reason
+	}
+	return report, nil
+}
+
+// stepDown hands the leadership over. The old leader waits longer than the
+// others before it campaigns, so one of them takes over.
+func (s *AuctionServer) stepDown() {
+	s.becomeFollower(s.term, "")
+	s.timeout += 2 * electionTicks
+}
+
+// refuseWhileDraining turns clients away from a draining replica, so they
+// move on to another one.
+func (s *AuctionServer) refuseWhileDraining(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if strings.HasPrefix(info.FullMethod, "/"+proto.AuctionServer_ServiceDesc.ServiceName+"/") {
+		s.mutex.Lock()
+		draining := s.draining
+		s.mutex.Unlock()
+		if draining {
+			return nil, status.Errorf(codes.Unavailable, "%s is draining", s.id)
+		}
+	}
+	return handler(ctx, req)
+}
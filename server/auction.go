@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	proto "Replication/grpc"
+	"Replication/money"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultAuction is the auction every server starts with. Requests that do
+// not name an auction go to it.
+const defaultAuction = "default"
+
+// defaultCurrency is the currency of the default auction and of auctions
+// created without one. It is fixed, as every replica has to agree on it
+// before there is a log.
+const defaultCurrency = "DKK"
+
+// auction is the state of one auction. It only changes when a log entry is
+// applied, so every replica agrees on it.
+type auction struct {
+	highestBid    int64 // in minor units of currency
+	highestBidder string
+	highestTS     int32
+	isAuctionOver bool
+	deadline      int64 // unix seconds, 0 if the auction has no end time
+	currency      string
+}
+
+// maxName is the longest bidder or auction name, in bytes. Names end up in
+// the log, so without a limit any caller could make it grow as it liked.
+const maxName = 64
+
+// checkName refuses a name that is longer than maxName.
+func checkName(kind, name string) error {
+	if len(name) > maxName {
+		return status.Errorf(codes.InvalidArgument, "%s name is longer than %d bytes", kind, maxName)
+	}
+	return nil
+}
+
+func auctionID(id string) string {
+	if id == "" {
+		return defaultAuction
+	}
+	return id
+}
+
+// apply runs a committed log entry. All replicas apply the same entries in
+// the same order, so they reach the same result.
+func (s *AuctionServer) apply(entry *proto.Entry) string {
+	switch op := entry.Op.(type) {
+	case *proto.Entry_Bid:
+		ack := s.applyBid(op.Bid)
+		s.addAuditRecord(entry, op.Bid, bidOutcome(ack))
+		return ack
+	case *proto.Entry_Reject:
+		s.addAuditRecord(entry, op.Reject.Bid, op.Reject.Reason)
+		return ""
+	case *proto.Entry_Register:
+		return s.applyRegister(op.Register)
+	case *proto.Entry_Create:
+		return s.applyCreate(op.Create)
+	case *proto.Entry_Close:
+		return s.applyClose(op.Close)
+	case *proto.Entry_AddWebhook:
+		return s.applyAddWebhook(op.AddWebhook)
+	case *proto.Entry_RemoveWebhook:
+		return s.applyRemoveWebhook(op.RemoveWebhook)
+	case *proto.Entry_Delivered:
+		return s.applyDelivered(op.Delivered)
+	}
+	return ""
+}
+
+// applyBid accepts a bid only if it is higher than the current highest bid.
+// Of two equal bids the one that came first in the log wins.
+func (s *AuctionServer) applyBid(req *proto.Amount) string {
+	a, ok := s.auctions[auctionID(req.Auction)]
+	if !ok || a.isAuctionOver {
+		return "fail"
+	}
+
+	s.lamportTime = max(s.lamportTime, req.Timestamp) + 1
+
+	ev := &proto.Event{Kind: "bid", Auction: auctionID(req.Auction), Index: s.lastApplied, Bidder: req.Bidder, Amount: req.Amount, Currency: a.currency}
+	defer s.publish(ev)
+
+	if req.Amount > a.highestBid {
+		if a.highestBidder != "" && a.highestBidder != req.Bidder {
+			ev.Outbid = a.highestBidder
+			s.notify(webhookPayload{Event: "outbid", Auction: ev.Auction, Bidder: a.highestBidder, OutbidBy: req.Bidder, Amount: req.Amount, Currency: a.currency})
+		}
+		a.highestBid = req.Amount
+		a.highestBidder = req.Bidder
+		a.highestTS = s.lamportTime
+		ev.Accepted, ev.HighestBid, ev.HighestBidder = true, req.Amount, req.Bidder
+		return "success"
+	}
+
+	ev.HighestBid, ev.HighestBidder = a.highestBid, a.highestBidder
+	return "BidException: Your bid was too low ;("
+}
+
+func (s *AuctionServer) applyCreate(req *proto.AuctionSpec) string {
+	if _, exists := s.auctions[req.Auction]; exists {
+		return "exists"
+	}
+	s.auctions[req.Auction] = &auction{deadline: req.Deadline, currency: req.Currency}
+	s.logger.Info("auction started", "auction", req.Auction)
+	return "success"
+}
+
+func (s *AuctionServer) applyClose(req *proto.AuctionRef) string {
+	a, ok := s.auctions[auctionID(req.Auction)]
+	if !ok {
+		return "unknown"
+	}
+	if !a.isAuctionOver {
+		a.isAuctionOver = true // ends auction
+		s.logger.Info("auction ended", "auction", auctionID(req.Auction))
+		ev := s.stateEvent(auctionID(req.Auction), a)
+		ev.Kind = "close"
+		s.publish(ev)
+		s.notify(webhookPayload{Event: "closed", Auction: ev.Auction, Bidder: a.highestBidder, Amount: a.highestBid, Currency: a.currency})
+		if a.highestBidder != "" {
+			s.notify(webhookPayload{Event: "winner", Auction: ev.Auction, Bidder: a.highestBidder, Amount: a.highestBid, Currency: a.currency})
+		}
+	}
+	return "success"
+}
+
+// Result answers with the state of an auction. It first puts an empty entry
+// through the log, so the answer includes every bid accepted before the call
+// even when this replica or a deposed leader is behind. Local reads skip
+// that and answer from this replica's state.
+func (s *AuctionServer) Result(ctx context.Context, req *proto.AuctionRef) (outcome *proto.Outcome, err error) {
+	defer func() { s.metrics.results.WithLabelValues(status.Code(err).String()).Inc() }()
+
+	if !req.Local {
+		_, err := s.propose(ctx, &proto.Entry{})
+		if errors.Is(err, errNotLeader) {
+			client, err := s.leaderClient()
+			if err != nil {
+				return nil, err
+			}
+			return client.Result(ctx, req)
+		}
+		if err != nil {
+			return nil, replicationError(err)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a, ok := s.auctions[auctionID(req.Auction)]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no auction called %s", auctionID(req.Auction))
+	}
+
+	return &proto.Outcome{
+		Result:        resultText(a),
+		HighestBid:    a.highestBid,
+		HighestBidder: a.highestBidder,
+		Currency:      a.currency,
+		Over:          a.isAuctionOver,
+	}, nil
+}
+
+// resultText describes the state of an auction for people, with the highest
+// bid in its currency.
+func resultText(a *auction) string {
+	bid := money.Format(a.highestBid, a.currency)
+	switch {
+	case a.isAuctionOver && a.highestBidder == "":
+		return "Auction over, there were no bids"
+	case a.isAuctionOver:
+		return "Auction over, the highest bidder was " + a.highestBidder + " with " + bid
+	case a.highestBidder == "":
+		return "Auction is ongoing, there are no bids yet"
+	}
+	return "Auction is ongoing, the highest bidder is " + a.highestBidder + " with " + bid
+}
+
+// CreateAuction starts a new auction. The leader turns the duration into a
+// deadline and closes the auction once it has passed.
+func (s *AuctionServer) CreateAuction(ctx context.Context, req *proto.AuctionSpec) (*proto.Ack, error) {
+	name := strings.TrimSpace(req.Auction)
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "auction name must not be empty")
+	}
+	if err := checkName("auction", name); err != nil {
+		return nil, err
+	}
+	if req.DurationSeconds < 0 {
+		return nil, status.Error(codes.InvalidArgument, "duration must not be negative")
+	}
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	if !money.Valid(currency) {
+		return nil, status.Errorf(codes.InvalidArgument, "%q is not a currency the auctions take", req.Currency)
+	}
+
+	spec := &proto.AuctionSpec{Auction: name, DurationSeconds: req.DurationSeconds, Currency: currency}
+	if req.DurationSeconds > 0 {
+		spec.Deadline = s.clock.Now().Unix() + req.DurationSeconds
+	}
+	ack, err := s.propose(ctx, &proto.Entry{Op: &proto.Entry_Create{Create: spec}})
+	if errors.Is(err, errNotLeader) {
+		client, err := s.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return client.CreateAuction(ctx, req)
+	}
+	if err != nil {
+		return nil, replicationError(err)
+	}
+	if ack == "exists" {
+		return nil, status.Errorf(codes.AlreadyExists, "auction %s already exists", name)
+	}
+	return &proto.Ack{Ack: ack}, nil
+}
+
+// CloseAuction ends an auction before its deadline.
+func (s *AuctionServer) CloseAuction(ctx context.Context, req *proto.AuctionRef) (*proto.Ack, error) {
+	ref := &proto.AuctionRef{Auction: auctionID(req.Auction)}
+	ack, err := s.propose(ctx, &proto.Entry{Op: &proto.Entry_Close{Close: ref}})
+	if errors.Is(err, errNotLeader) {
+		client, err := s.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return client.CloseAuction(ctx, req)
+	}
+	if err != nil {
+		return nil, replicationError(err)
+	}
+	if ack == "unknown" {
+		return nil, status.Errorf(codes.NotFound, "no auction called %s", ref.Auction)
+	}
+	return &proto.Ack{Ack: ack}, nil
+}
+
+// closeExpired has the leader close the auctions whose deadline has passed.
+func (s *AuctionServer) closeExpired() {
+	now := s.clock.Now().Unix()
+	// in order of name, so the simulator can replay a run
+	for _, id := range slices.Sorted(maps.Keys(s.auctions)) {
+		a := s.auctions[id]
+		if a.isAuctionOver || a.deadline == 0 || now < a.deadline || s.closing[id] {
+			continue
+		}
+		s.closing[id] = true
+		s.appendEntry(&proto.Entry{Op: &proto.Entry_Close{Close: &proto.AuctionRef{Auction: id}}})
+	}
+}
+
+// AuctionTimer ends the default auction after auctionDuration by putting a
+// close entry in the log, so every replica stops accepting bids at the same
+// point.
+func (s *AuctionServer) AuctionTimer() {
+	select {
+	case <-s.clock.After(auctionDuration): // makes the auction run for an amount of time
+	case <-s.done:
+		return
+	}
+
+	for {
+		s.mutex.Lock()
+		over := s.auctions[defaultAuction].isAuctionOver
+		s.mutex.Unlock()
+		if over {
+			return
+		}
+
+		// only the leader can close the auction, followers wait for it
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		s.propose(ctx, &proto.Entry{Op: &proto.Entry_Close{Close: &proto.AuctionRef{Auction: defaultAuction}}})
+		cancel()
+
+		select {
+		case <-s.clock.After(time.Second):
+		case <-s.done:
+			return
+		}
+	}
+}
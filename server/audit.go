@@ -0,0 +1,92 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	proto "Replication/grpc"
+	"Replication/ledger"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Every bid the leader decides on in an auction that exists goes into the
+// auction's audit trail: those in the log, accepted or too low, and those
+// the leader turned away before, because the auction was over or the token
+// was wrong. Bids refused before they reach the leader, by the rate limits
+// or because the token is another bidder's, are left out. The trail is part
+// of the replicated state, and its records are hash-chained, see the ledger
+// package.
+
+// ExportAudit answers from this replica's state, which may be a little
+// behind the leader's.
+func (s *AuctionServer) ExportAudit(req *proto.AuctionRef, stream proto.AuctionServer_ExportAuditServer) error {
+	id := auctionID(req.Auction)
+	s.mutex.Lock()
+	_, ok := s.auctions[id]
+	trail := slices.Clone(s.trails[id])
+	s.mutex.Unlock()
+	if !ok {
+		return status.Errorf(codes.NotFound, "no auction called %s", id)
+	}
+	for _, rec := range trail {
+		if err := stream.Send(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addAuditRecord appends a bid and its outcome to its auction's trail.
+func (s *AuctionServer) addAuditRecord(entry *proto.Entry, bid *proto.Amount, reason string) {
+	id := auctionID(bid.Auction)
+	a, ok := s.auctions[id]
+	if !ok {
+		return
+	}
+	currency := bid.Currency
+	if currency == "" {
+		currency = a.currency
+	}
+	rec := ledger.Record{
+		Index:     s.lastApplied,
+		Time:      time.Unix(0, entry.Time).UTC(),
+		Replica:   entry.Replica,
+		Auction:   id,
+		Bidder:    bid.Bidder,
+		Amount:    bid.Amount,
+		Currency:  currency,
+		Timestamp: bid.Timestamp,
+		Accepted:  reason == "accepted",
+		Reason:    reason,
+	}
+	prev := ""
+	if trail := s.trails[id]; len(trail) > 0 {
+		prev = trail[len(trail)-1].Hash
+	}
+	ledger.Link(prev, &rec)
+	s.trails[id] = append(s.trails[id], rec.Proto())
+}
+
+// reject puts a bid the leader turned away in the log, for the audit trail.
+// It does not wait for the entry to commit.
+func (s *AuctionServer) reject(replica string, req *proto.Amount, reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.role != leader {
+		return
+	}
+	bid := &proto.Amount{Amount: req.Amount, Bidder: req.Bidder, Timestamp: req.Timestamp, Auction: auctionID(req.Auction), Currency: req.Currency}
+	s.appendEntry(&proto.Entry{Replica: replica, Op: &proto.Entry_Reject{Reject: &proto.Rejection{Bid: bid, Reason: reason}}})
+}
+
+// auditRecords lists every auction's trail, the auctions sorted by name.
+func (s *AuctionServer) auditRecords() []*proto.AuditRecord {
+	var records []*proto.AuditRecord
+	for _, id := range slices.Sorted(maps.Keys(s.trails)) {
+		records = append(records, s.trails[id]...)
+	}
+	return records
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	proto "Replication/grpc"
+	"Replication/security"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// methodRoles lists the roles allowed to call each method. A nil list means
+// anyone may call it; methods missing from the list are refused. Replicas may
+// call the public methods because followers pass requests on to the leader.
+var methodRoles = map[string][]string{
+	proto.AuctionServer_Register_FullMethodName:      nil,
+	proto.AuctionServer_Login_FullMethodName:         nil,
+	proto.AuctionServer_Bid_FullMethodName:           {security.RoleBidder, security.RoleReplica},
+	proto.AuctionServer_Result_FullMethodName:        {security.RoleBidder, security.RoleAuctioneer, security.RoleReplica},
+	proto.AuctionServer_CreateAuction_FullMethodName: {security.RoleAuctioneer, security.RoleReplica},
+	proto.AuctionServer_CloseAuction_FullMethodName:  {security.RoleAuctioneer, security.RoleReplica},
+	proto.AuctionServer_Watch_FullMethodName:         {security.RoleBidder, security.RoleAuctioneer, security.RoleReplica},
+	proto.AuctionServer_AddWebhook_FullMethodName:    {security.RoleAuctioneer, security.RoleReplica},
+	proto.AuctionServer_RemoveWebhook_FullMethodName: {security.RoleAuctioneer, security.RoleReplica},
+	proto.AuctionServer_ListWebhooks_FullMethodName:  {security.RoleAuctioneer, security.RoleReplica},
+	proto.AuctionServer_ExportAudit_FullMethodName:   {security.RoleAuctioneer, security.RoleAdmin},
+	proto.Replica_RequestVote_FullMethodName:         {security.RoleReplica},
+	proto.Replica_AppendEntries_FullMethodName:       {security.RoleReplica},
+	proto.Replica_InstallSnapshot_FullMethodName:     {security.RoleReplica},
+	proto.Faults_SetFaults_FullMethodName:            {security.RoleAdmin},
+	proto.Faults_GetFaults_FullMethodName:            {security.RoleAdmin},
+	proto.AuctionAdmin_Status_FullMethodName:         {security.RoleAdmin},
+	proto.AuctionAdmin_Snapshot_FullMethodName:       {security.RoleAdmin},
+	proto.AuctionAdmin_StepDown_FullMethodName:       {security.RoleAdmin},
+	proto.AuctionAdmin_Drain_FullMethodName:          {security.RoleAdmin},
+	proto.AuctionAdmin_VerifyLedger_FullMethodName:   {security.RoleAdmin},
+	healthpb.Health_Check_FullMethodName:             nil,
+	healthpb.Health_Watch_FullMethodName:             nil,
+}
+
+// authorizer checks the bearer token of every call against methodRoles.
+// Without a signer all calls are let through.
+type authorizer struct {
+	signer *security.Signer
+}
+
+func (a authorizer) authorize(ctx context.Context, method string) (context.Context, error) {
+	if a.signer == nil {
+		return ctx, nil
+	}
+	roles, known := methodRoles[method]
+	if !known {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is not allowed", method)
+	}
+	if roles == nil {
+		return ctx, nil
+	}
+
+	token, ok := security.TokenFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	claims, err := a.signer.Verify(token)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid bearer token: %v", err)
+	}
+	if !slices.Contains(roles, claims.Role) {
+		return nil, status.Errorf(codes.PermissionDenied, "role %s may not call %s", claims.Role, method)
+	}
+	return security.WithClaims(ctx, claims), nil
+}
+
+func (a authorizer) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a authorizer) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authorizedStream carries the caller's claims to a streaming handler.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
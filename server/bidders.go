@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	proto "Replication/grpc"
+	"Replication/security"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// bidderTokenValidity is how long the access token handed out by Register
+// lasts when bearer tokens are required.
+const bidderTokenValidity = 24 * time.Hour
+
+// Register claims a bidder name. The leader makes up a random token, puts
+// only its hash in the log and hands the token to the client, which has to
+// send it with every bid.
+func (s *AuctionServer) Register(ctx context.Context, req *proto.Registration) (*proto.Credentials, error) {
+	name := strings.TrimSpace(req.Bidder)
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "bidder name must not be empty")
+	}
+	if err := checkName("bidder", name); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	_, taken := s.bidders[name]
+	isLeader := s.role == leader
+	s.mutex.Unlock()
+
+	if taken {
+		return nil, status.Errorf(codes.AlreadyExists, "bidder %s is already registered", name)
+	}
+	if !isLeader {
+		client, err := s.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return client.Register(ctx, req)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create token: %v", err)
+	}
+	entry := &proto.Entry{Op: &proto.Entry_Register{Register: &proto.Registration{
+		Bidder:    name,
+		TokenHash: hashToken(token),
+	}}}
+	ack, err := s.propose(ctx, entry)
+	if err != nil {
+		return nil, replicationError(err)
+	}
+	if ack != "success" {
+		return nil, status.Errorf(codes.AlreadyExists, "bidder %s is already registered", name)
+	}
+
+	return s.credentials(name, token)
+}
+
+// Login lets a bidder that registered earlier get a new access token, by
+// showing the token it got from Register. Like Register it is answered by
+// the leader, which knows every registration.
+func (s *AuctionServer) Login(ctx context.Context, req *proto.Credentials) (*proto.Credentials, error) {
+	s.mutex.Lock()
+	isLeader := s.role == leader
+	s.mutex.Unlock()
+
+	if !isLeader {
+		client, err := s.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return client.Login(ctx, req)
+	}
+	if err := s.authenticate(req.Bidder, req.Token); err != nil {
+		return nil, err
+	}
+	return s.credentials(req.Bidder, req.Token)
+}
+
+// credentials hands token back to the bidder, with an access token if the
+// servers require them.
+func (s *AuctionServer) credentials(bidder, token string) (*proto.Credentials, error) {
+	creds := &proto.Credentials{
+		Bidder: bidder,
+		Token:  token,
+	}
+	if s.signer != nil {
+		var err error
+		creds.AccessToken, err = s.signer.Issue(bidder, security.RoleBidder, bidderTokenValidity)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to issue access token: %v", err)
+		}
+	}
+	return creds, nil
+}
+
+// authenticate checks that token belongs to bidder. Only the leader calls it,
+// as it is the only replica sure to know every registration.
+func (s *AuctionServer) authenticate(bidder, token string) error {
+	s.mutex.Lock()
+	hash, ok := s.bidders[bidder]
+	s.mutex.Unlock()
+
+	if !ok {
+		return status.Errorf(codes.Unauthenticated, "bidder %s is not registered", bidder)
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashToken(token))) != 1 {
+		return status.Errorf(codes.Unauthenticated, "wrong token for bidder %s", bidder)
+	}
+	return nil
+}
+
+// registered tells if bidder is in the registry.
+func (s *AuctionServer) registered(bidder string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.bidders[bidder]
+	return ok
+}
+
+// applyRegister adds a bidder to the registry unless the name is taken.
+func (s *AuctionServer) applyRegister(req *proto.Registration) string {
+	if _, taken := s.bidders[req.Bidder]; taken {
+		return "taken"
+	}
+	s.bidders[req.Bidder] = req.TokenHash
+	return "success"
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// replicationError turns an error from propose into a status for the client.
+func replicationError(err error) error {
+	switch {
+	case errors.Is(err, errNotLeader), errors.Is(err, errLostLeadership):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	proto "Replication/grpc"
+
+	bolt "go.etcd.io/bbolt"
+	gproto "google.golang.org/protobuf/proto"
+)
+
+// boltStore keeps the log in a bbolt database, one key per entry, so that
+// compacting and truncating only touch the entries they drop. Every change
+// is a transaction that bbolt syncs before it returns.
+type boltStore struct {
+	db *bolt.DB
+}
+
+var (
+	stateBucket = []byte("state") // the hard state and the snapshot
+	logBucket   = []byte("log")   // entries by index, big-endian so they sort
+	stateKey    = []byte("hardState")
+	snapshotKey = []byte("snapshot")
+)
+
+func openBoltStore(path string) (*boltStore, error) {
+	// a second process on the same file would wait for the lock forever
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{stateBucket, logBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func indexKey(index int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(index))
+}
+
+func (b *boltStore) Load() (Saved, error) {
+	var saved Saved
+	err := b.db.View(func(tx *bolt.Tx) error {
+		state := tx.Bucket(stateBucket)
+		if data := state.Get(stateKey); data != nil {
+			hard := &proto.HardState{}
+			if err := gproto.Unmarshal(data, hard); err != nil {
+				return err
+			}
+			saved.Term, saved.VotedFor = hard.Term, hard.VotedFor
+		}
+		if data := state.Get(snapshotKey); data != nil {
+			saved.Snapshot = &proto.Snapshot{}
+			if err := gproto.Unmarshal(data, saved.Snapshot); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(logBucket).ForEach(func(k, v []byte) error {
+			entry := &proto.Entry{}
+			if err := gproto.Unmarshal(v, entry); err != nil {
+				return fmt.Errorf("entry %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			saved.Entries = append(saved.Entries, entry)
+			return nil
+		})
+	})
+	return saved, err
+}
+
+func (b *boltStore) SaveState(term int64, votedFor string) error {
+	data, err := gproto.Marshal(&proto.HardState{Term: term, VotedFor: votedFor})
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Put(stateKey, data)
+	})
+}
+
+func (b *boltStore) Append(index int64, entries []*proto.Entry) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		log := tx.Bucket(logBucket)
+		if err := deleteFrom(log, index); err != nil {
+			return err
+		}
+		for i, entry := range entries {
+			data, err := gproto.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := log.Put(indexKey(index+int64(i)), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltStore) Truncate(index int64) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return deleteFrom(tx.Bucket(logBucket), index)
+	})
+}
+
+// deleteFrom deletes the entries from index on.
+func deleteFrom(log *bolt.Bucket, index int64) error {
+	var keys [][]byte
+	c := log.Cursor()
+	for k, _ := c.Seek(indexKey(index)); k != nil; k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := log.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *boltStore) SaveSnapshot(snap *proto.Snapshot) error {
+	data, err := gproto.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(stateBucket).Put(snapshotKey, data); err != nil {
+			return err
+		}
+		log := tx.Bucket(logBucket)
+		var keys [][]byte
+		c := log.Cursor()
+		for k, _ := c.First(); k != nil && int64(binary.BigEndian.Uint64(k)) <= snap.Index; k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			if err := log.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
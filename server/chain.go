@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	proto "Replication/grpc"
+	"Replication/ledger"
+)
+
+// The log is a hash chain: the leader puts the hash of the entry before into
+// every entry it appends. A follower checks that the leader's entries chain
+// on to its own log, and that its entry at the leader's prevLogIndex has the
+// same hash as the leader's. Entries with the same index and term are the
+// same entry, so a difference means a log was changed behind replication's
+// back. The follower then refuses the leader's entries rather than build on
+// a broken chain, and both replicas keep the first mismatch for VerifyLedger.
+
+// hashAt returns the hash of the entry at index, which must not be before
+// base.
+func (s *AuctionServer) hashAt(index int64) string {
+	if index == s.base() {
+		if s.snapshot == nil {
+			return ""
+		}
+		return s.snapshot.Hash
+	}
+	return ledger.EntryHash(s.entry(index))
+}
+
+// noteMismatch keeps the first mismatch found while replicating with peer.
+func (s *AuctionServer) noteMismatch(index int64, peer, reason string) {
+	if s.mismatch != nil {
+		return
+	}
+	s.mismatch = &proto.LedgerReport{MismatchIndex: index, Peer: peer, Reason: reason}
+	s.logger.Error("hash chain differs", "index", index, "peer", peer, "reason", reason)
+}
+
+// verifyChain checks that every entry after the snapshot holds the hash of
+// the one before. It returns the first entry that does not, or 0. A change to
+// the last entry only shows when comparing with another replica.
+func (s *AuctionServer) verifyChain() (int64, string) {
+	prev := s.hashAt(s.base())
+	for i := s.base() + 1; i <= s.lastIndex(); i++ {
+		entry := s.entry(i)
+		if entry.PrevHash != prev {
+			return i, fmt.Sprintf("entry %d does not hold the hash of entry %d, one of them was changed", i, i-1)
+		}
+		prev = ledger.EntryHash(entry)
+	}
+	return 0, ""
+}
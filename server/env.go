@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	proto "Replication/grpc"
+
+	"google.golang.org/grpc"
+)
+
+// The replica reaches the clock, the other replicas and randomness only
+// through these interfaces, so the simulator in simulator_test.go can run a
+// whole cluster in one goroutine and replay it from a seed.
+
+// Clock is the time as the replica sees it.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Transport carries the replication calls to the other replicas. The calls
+// return at once; done is called later with the reply, or never if the call
+// fails. ctx carries the trace of the entries being sent, if any.
+type Transport interface {
+	RequestVote(peer string, req *proto.VoteRequest, done func(*proto.VoteReply))
+	AppendEntries(ctx context.Context, peer string, req *proto.AppendRequest, done func(*proto.AppendReply))
+	InstallSnapshot(ctx context.Context, peer string, req *proto.SnapshotRequest, done func(*proto.AppendReply))
+}
+
+// grpcTransport calls the other replicas over their gRPC connections.
+type grpcTransport struct {
+	conns   map[string]*grpc.ClientConn
+	metrics *metrics
+}
+
+func (t grpcTransport) RequestVote(peer string, req *proto.VoteRequest, done func(*proto.VoteReply)) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		defer cancel()
+		start := time.Now()
+		reply, err := proto.NewReplicaClient(t.conns[peer]).RequestVote(ctx, req)
+		t.metrics.observe(peer, "RequestVote", time.Since(start), err)
+		if err == nil {
+			done(reply)
+		}
+	}()
+}
+
+func (t grpcTransport) AppendEntries(ctx context.Context, peer string, req *proto.AppendRequest, done func(*proto.AppendReply)) {
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+		defer cancel()
+		start := time.Now()
+		reply, err := proto.NewReplicaClient(t.conns[peer]).AppendEntries(ctx, req)
+		t.metrics.observe(peer, "AppendEntries", time.Since(start), err)
+		if err == nil {
+			done(reply)
+		}
+	}()
+}
+
+func (t grpcTransport) InstallSnapshot(ctx context.Context, peer string, req *proto.SnapshotRequest, done func(*proto.AppendReply)) {
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+		defer cancel()
+		start := time.Now()
+		reply, err := proto.NewReplicaClient(t.conns[peer]).InstallSnapshot(ctx, req)
+		t.metrics.observe(peer, "InstallSnapshot", time.Since(start), err)
+		if err == nil {
+			done(reply)
+		}
+	}()
+}
+
+// Rand picks the election timeouts.
+type Rand interface {
+	Intn(n int) int
+}
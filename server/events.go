@@ -0,0 +1,126 @@
+package main
+
+import (
+	proto "Replication/grpc"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Every change to an auction is published as an event to the Watch calls
+// following it. Events come from applying log entries, so every replica
+// sends the same events in the same order, and their log index tells a
+// client that switches replicas which events it has already seen.
+
+// watchBuffer is how many events a watcher may fall behind before it is
+// dropped.
+const watchBuffer = 64
+
+type watcher struct {
+	auction string
+	events  chan *proto.Event // closed when the watcher is dropped
+}
+
+// Watch sends the auction's state and then every bid and close as this
+// replica applies it. The stream ends once the auction is over.
+func (s *AuctionServer) Watch(req *proto.AuctionRef, stream proto.AuctionServer_WatchServer) error {
+	id := auctionID(req.Auction)
+	s.mutex.Lock()
+	if s.asked != nil || s.recovering || s.draining {
+		s.mutex.Unlock()
+		return status.Errorf(codes.Unavailable, "%s is not serving", s.id)
+	}
+	a, ok := s.auctions[id]
+	if !ok {
+		s.mutex.Unlock()
+		return status.Errorf(codes.NotFound, "no auction called %s", id)
+	}
+	w := &watcher{auction: id, events: make(chan *proto.Event, watchBuffer)}
+	w.events <- s.stateEvent(id, a)
+	s.watchers[w] = true
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		s.dropWatcher(w)
+		s.mutex.Unlock()
+	}()
+	for {
+		select {
+		case ev, ok := <-w.events:
+			if !ok {
+				return status.Errorf(codes.Unavailable, "%s stopped sending events, the watcher fell behind or the server is draining", s.id)
+			}
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+			if ev.Over {
+				return nil
+			}
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-s.done:
+			return status.Errorf(codes.Unavailable, "%s is shutting down", s.id)
+		}
+	}
+}
+
+// stateEvent describes an auction as of the last applied entry.
+func (s *AuctionServer) stateEvent(id string, a *auction) *proto.Event {
+	return &proto.Event{
+		Kind:          "state",
+		Auction:       id,
+		Index:         s.lastApplied,
+		HighestBid:    a.highestBid,
+		HighestBidder: a.highestBidder,
+		Over:          a.isAuctionOver,
+		Currency:      a.currency,
+	}
+}
+
+// publish hands ev to the watchers of its auction. A watcher that has fallen
+// too far behind is dropped rather than holding up the replica. Call it with
+// the mutex held.
+func (s *AuctionServer) publish(ev *proto.Event) {
+	for w := range s.watchers {
+		if w.auction != ev.Auction {
+			continue
+		}
+		select {
+		case w.events <- ev:
+		default:
+			s.dropWatcher(w)
+		}
+	}
+}
+
+// publishStates sends every watcher the state of its auction, after the
+// state changed without going through the log, as when a snapshot is
+// installed.
+func (s *AuctionServer) publishStates() {
+	for w := range s.watchers {
+		if a, ok := s.auctions[w.auction]; ok {
+			select {
+			case w.events <- s.stateEvent(w.auction, a):
+			default:
+				s.dropWatcher(w)
+			}
+		}
+	}
+}
+
+// dropWatcher ends a Watch call. Call it with the mutex held.
+func (s *AuctionServer) dropWatcher(w *watcher) {
+	if s.watchers[w] {
+		delete(s.watchers, w)
+		close(w.events)
+	}
+}
+
+// dropWatchers ends all Watch calls, so their clients move on to another
+// replica.
+func (s *AuctionServer) dropWatchers() {
+	for w := range s.watchers {
+		s.dropWatcher(w)
+	}
+}
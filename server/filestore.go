@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	proto "Replication/grpc"
+
+	gproto "google.golang.org/protobuf/proto"
+)
+
+// fileStore appends a record for every change to a file and syncs it before
+// returning. Each record is its length, a CRC-32 of it and a StoreRecord.
+// A crash may cut the last record short; loading drops it, as the change it
+// held was never confirmed to anyone.
+type fileStore struct {
+	path string
+	file *os.File
+	mem  memoryStore // what the file holds, to rewrite it from
+}
+
+func openFileStore(path string) (*fileStore, error) {
+	f := &fileStore{path: path}
+	if err := f.replay(); err != nil {
+		return nil, fmt.Errorf("load %s: %w", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	f.file = file
+	return f, nil
+}
+
+// maxRecord is the longest record the file takes, far more than any
+// snapshot, so a broken length cannot make loading allocate gigabytes.
+const maxRecord = 64 << 20
+
+// replay reads the records into mem. A crash can only break the record at
+// the end, so that one is cut off; a broken record with more after it means
+// the file is damaged, and dropping the rest would lose votes and entries
+// this replica has promised, so replay fails instead.
+func (f *fileStore) replay() error {
+	file, err := os.Open(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(file)
+	var good int64 // bytes up to the end of the last whole record
+	for good < info.Size() {
+		data, err := readRecord(r, info.Size()-good)
+		if err == io.ErrUnexpectedEOF {
+			return os.Truncate(f.path, good)
+		}
+		rec := &proto.StoreRecord{}
+		if err == nil {
+			err = gproto.Unmarshal(data, rec)
+		}
+		if err != nil {
+			if good+8+int64(len(data)) == info.Size() {
+				return os.Truncate(f.path, good)
+			}
+			return fmt.Errorf("record at byte %d: %w", good, err)
+		}
+		if err := f.mem.apply(rec); err != nil {
+			return err
+		}
+		good += 8 + int64(len(data))
+	}
+	return nil
+}
+
+// readRecord reads the next record out of the remaining bytes of the file.
+// It returns io.ErrUnexpectedEOF if the record goes past the end, and the
+// data along with the error if the checksum does not match.
+func readRecord(r io.Reader, remaining int64) ([]byte, error) {
+	var head [8]byte
+	if remaining < int64(len(head)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint32(head[:4]))
+	if size > remaining-int64(len(head)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if size > maxRecord {
+		return nil, fmt.Errorf("record of %d bytes is too long", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(head[4:]) {
+		return data, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
+
+// apply replays a record of the file.
+func (m *memoryStore) apply(rec *proto.StoreRecord) error {
+	switch op := rec.Op.(type) {
+	case *proto.StoreRecord_State:
+		return m.SaveState(op.State.Term, op.State.VotedFor)
+	case *proto.StoreRecord_Entry:
+		return m.Append(m.first()+int64(len(m.saved.Entries)), []*proto.Entry{op.Entry})
+	case *proto.StoreRecord_Truncate:
+		return m.Truncate(op.Truncate)
+	case *proto.StoreRecord_Snapshot:
+		return m.SaveSnapshot(op.Snapshot)
+	}
+	return fmt.Errorf("unknown record %T", rec.Op)
+}
+
+// writeRecords writes the records to w in one go.
+func writeRecords(w io.Writer, records ...*proto.StoreRecord) error {
+	var buf []byte
+	for _, rec := range records {
+		data, err := gproto.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+		buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(data))
+		buf = append(buf, data...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// append appends the records to the file and syncs it.
+func (f *fileStore) append(records ...*proto.StoreRecord) error {
+	if err := writeRecords(f.file, records...); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (f *fileStore) Load() (Saved, error) {
+	return f.mem.Load()
+}
+
+func (f *fileStore) SaveState(term int64, votedFor string) error {
+	f.mem.SaveState(term, votedFor)
+	return f.append(&proto.StoreRecord{Op: &proto.StoreRecord_State{State: &proto.HardState{Term: term, VotedFor: votedFor}}})
+}
+
+func (f *fileStore) Append(index int64, entries []*proto.Entry) error {
+	var records []*proto.StoreRecord
+	if index < f.mem.first()+int64(len(f.mem.saved.Entries)) {
+		records = append(records, &proto.StoreRecord{Op: &proto.StoreRecord_Truncate{Truncate: index}})
+	}
+	if err := f.mem.Append(index, entries); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		records = append(records, &proto.StoreRecord{Op: &proto.StoreRecord_Entry{Entry: entry}})
+	}
+	return f.append(records...)
+}
+
+func (f *fileStore) Truncate(index int64) error {
+	if err := f.mem.Truncate(index); err != nil {
+		return err
+	}
+	return f.append(&proto.StoreRecord{Op: &proto.StoreRecord_Truncate{Truncate: index}})
+}
+
+// SaveSnapshot writes a new file with the snapshot and the entries after it
+// and moves it over the old one, so the file does not keep growing.
+func (f *fileStore) SaveSnapshot(snap *proto.Snapshot) error {
+	if err := f.mem.SaveSnapshot(snap); err != nil {
+		return err
+	}
+	saved := f.mem.saved
+	records := []*proto.StoreRecord{
+		{Op: &proto.StoreRecord_State{State: &proto.HardState{Term: saved.Term, VotedFor: saved.VotedFor}}},
+		{Op: &proto.StoreRecord_Snapshot{Snapshot: snap}},
+	}
+	for _, entry := range saved.Entries {
+		records = append(records, &proto.StoreRecord{Op: &proto.StoreRecord_Entry{Entry: entry}})
+	}
+
+	tmp := f.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	err = writeRecords(file, records...)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		file.Close()
+		return err
+	}
+	// the rename only lasts once the directory is synced
+	if dir, err := os.Open(filepath.Dir(f.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	f.file.Close()
+	f.file = file
+	return nil
+}
+
+func (f *fileStore) Close() error {
+	return f.file.Close()
+}
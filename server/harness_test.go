@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"Replication/faults"
+	proto "Replication/grpc"
+	"Replication/security"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// harness runs a cluster of replicas in one process, connected over bufconn
+// instead of TCP. Tests can crash, restart and partition the replicas.
+type harness struct {
+	t      *testing.T
+	signer *security.Signer
+	addrs  []string
+
+	mutex  sync.Mutex
+	nodes  map[string]*harnessNode
+	cut    map[[2]string]bool // links that are down, in both directions
+	faults map[string]*faults.Injector
+
+	storeKind string // memory if empty, see useStores
+	storeDir  string
+}
+
+type harnessNode struct {
+	addr   string
+	lis    *bufconn.Listener
+	server *AuctionServer
+	grpc   *grpc.Server
+	client proto.AuctionServerClient
+	health healthpb.HealthClient
+	admin  proto.AuctionAdminClient
+	store  Store
+	up     bool
+}
+
+// clientAddr is the name the tests' own connections dial from. Partitions
+// never cut it off, so tests can talk to every replica that is up.
+const clientAddr = "client"
+
+// newHarness starts n replicas. With a signer the replicas require bearer
+// tokens.
+func newHarness(t *testing.T, n int, signer *security.Signer) *harness {
+	t.Helper()
+	h := &harness{
+		t:      t,
+		signer: signer,
+		nodes:  make(map[string]*harnessNode),
+		cut:    make(map[[2]string]bool),
+		faults: make(map[string]*faults.Injector),
+	}
+	for i := 0; i < n; i++ {
+		h.addrs = append(h.addrs, fmt.Sprintf("node-%d", i))
+	}
+	for i, addr := range h.addrs {
+		h.nodes[addr] = &harnessNode{addr: addr}
+		// the injectors outlive restarts, and their seeds keep runs alike
+		h.faults[addr] = faults.NewInjector(addr, int64(i+1))
+	}
+	for _, addr := range h.addrs {
+		conn, err := grpc.Dial(addr, h.dialOptions(clientAddr)...)
+		if err != nil {
+			t.Fatalf("dial %s: %v", addr, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		h.mutex.Lock()
+		h.nodes[addr].client = proto.NewAuctionServerClient(conn)
+		h.nodes[addr].health = healthpb.NewHealthClient(conn)
+		h.nodes[addr].admin = proto.NewAuctionAdminClient(conn)
+		h.mutex.Unlock()
+	}
+	for i := range h.addrs {
+		h.start(i)
+	}
+	t.Cleanup(func() {
+		for i := range h.addrs {
+			h.crash(i)
+		}
+	})
+	return h
+}
+
+func (h *harness) dialOptions(from string) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(h.dialer(from)),
+		grpc.WithChainUnaryInterceptor(h.link(from)),
+		// reconnect quickly once a crashed replica is back
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.Config{BaseDelay: 20 * time.Millisecond, Multiplier: 1.5, MaxDelay: 200 * time.Millisecond},
+			MinConnectTimeout: 200 * time.Millisecond,
+		}),
+	}
+}
+
+// dialer connects to the current listener of a replica, if it is up and
+// reachable from from.
+func (h *harness) dialer(from string) func(context.Context, string) (net.Conn, error) {
+	return func(ctx context.Context, target string) (net.Conn, error) {
+		h.mutex.Lock()
+		node, ok := h.nodes[target]
+		reachable := ok && node.up && !h.cut[[2]string{from, target}]
+		var lis *bufconn.Listener
+		if reachable {
+			lis = node.lis
+		}
+		h.mutex.Unlock()
+
+		if !reachable {
+			return nil, errors.New("unreachable")
+		}
+		conn, err := lis.DialContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(conn, from+"\n"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// namedListener hands out connections whose remote address is the name the
+// dialer sent as the first line, so replicas see each other, and clientAddr,
+// as they would see the hosts of a real cluster.
+type namedListener struct {
+	net.Listener
+}
+
+func (l namedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		var name []byte
+		b := make([]byte, 1)
+		for err == nil && (len(name) == 0 || name[len(name)-1] != '\n') {
+			if _, err = conn.Read(b); err == nil {
+				name = append(name, b[0])
+			}
+		}
+		if err != nil {
+			// Serve stops on an error, so only the connection is dropped
+			conn.Close()
+			continue
+		}
+		return namedConn{Conn: conn, from: harnessAddr(name[:len(name)-1])}, nil
+	}
+}
+
+type namedConn struct {
+	net.Conn
+	from net.Addr
+}
+
+func (c namedConn) RemoteAddr() net.Addr { return c.from }
+
+type harnessAddr string
+
+func (a harnessAddr) Network() string { return "harness" }
+func (a harnessAddr) String() string  { return string(a) }
+
+// link fails calls over connections that a partition has cut since they
+// were made.
+func (h *harness) link(from string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		h.mutex.Lock()
+		cut := h.cut[[2]string{from, cc.Target()}]
+		h.mutex.Unlock()
+		if cut {
+			return status.Error(codes.Unavailable, "partitioned")
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// useStores restarts every replica with a store of the given kind, which
+// they keep across later restarts.
+func (h *harness) useStores(kind string) {
+	h.t.Helper()
+	h.storeKind, h.storeDir = kind, h.t.TempDir()
+	for i := range h.addrs {
+		h.restart(i)
+	}
+}
+
+// start boots replica i with what its store has saved, or else with empty
+// state, like a freshly started process.
+func (h *harness) start(i int) {
+	h.t.Helper()
+	addr := h.addrs[i]
+
+	dialOpts := append(h.dialOptions(addr), grpc.WithChainUnaryInterceptor(h.faults[addr].UnaryClientInterceptor()))
+	if h.signer != nil {
+		token, err := h.signer.Issue(addr, security.RoleReplica, 0)
+		if err != nil {
+			h.t.Fatalf("issue replica token: %v", err)
+		}
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(security.NewBearerToken(token)))
+	}
+	s, err := NewAuctionServer(addr, h.addrs, dialOpts...)
+	if err != nil {
+		h.t.Fatalf("new server %s: %v", addr, err)
+	}
+	s.signer = h.signer
+	s.insecure = h.signer == nil // as in main, the harness has no TLS
+	var store Store
+	if h.storeKind != "" {
+		if store, err = openStore(h.storeKind, filepath.Join(h.storeDir, addr)); err != nil {
+			h.t.Fatalf("open store of %s: %v", addr, err)
+		}
+		if err := s.UseStore(store); err != nil {
+			h.t.Fatalf("load store of %s: %v", addr, err)
+		}
+	}
+	auth := authorizer{signer: h.signer}
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(auth.unary, s.refuseWhileDraining, s.limitRate),
+		grpc.ChainStreamInterceptor(auth.stream))
+	s.RegisterServices(grpcServer)
+
+	lis := bufconn.Listen(1 << 20)
+	go grpcServer.Serve(namedListener{lis})
+	s.Start()
+
+	h.mutex.Lock()
+	node := h.nodes[addr]
+	node.lis, node.server, node.grpc, node.store, node.up = lis, s, grpcServer, store, true
+	h.mutex.Unlock()
+}
+
+// crash stops replica i and throws away what it has not saved.
+func (h *harness) crash(i int) {
+	h.mutex.Lock()
+	node := h.nodes[h.addrs[i]]
+	wasUp := node.up
+	node.up = false
+	h.mutex.Unlock()
+
+	if wasUp {
+		node.server.Stop()
+		node.grpc.Stop()
+		if node.store != nil {
+			node.store.Close()
+		}
+	}
+}
+
+func (h *harness) restart(i int) {
+	h.crash(i)
+	h.start(i)
+}
+
+// partition cuts every link between replicas in different groups. Replicas
+// not named in any group are cut off from everybody.
+func (h *harness) partition(groups ...[]int) {
+	group := make(map[string]int)
+	for g, members := range groups {
+		for _, i := range members {
+			group[h.addrs[i]] = g + 1
+		}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.cut = make(map[[2]string]bool)
+	for _, a := range h.addrs {
+		for _, b := range h.addrs {
+			if a != b && (group[a] == 0 || group[a] != group[b]) {
+				h.cut[[2]string{a, b}] = true
+			}
+		}
+	}
+}
+
+func (h *harness) heal() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.cut = make(map[[2]string]bool)
+}
+
+// inject gives every replica the same fault rules. Rules without from or to
+// apply to all links.
+func (h *harness) inject(rules ...*proto.FaultRule) {
+	h.t.Helper()
+	for _, in := range h.faults {
+		if err := in.Set(&proto.FaultRules{Rules: rules}); err != nil {
+			h.t.Fatalf("set fault rules: %v", err)
+		}
+	}
+}
+
+func (h *harness) client(i int) proto.AuctionServerClient {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.nodes[h.addrs[i]].client
+}
+
+// serving tells whether replica i reports that it is serving.
+func (h *harness) serving(i int) bool {
+	h.mutex.Lock()
+	client := h.nodes[h.addrs[i]].health
+	h.mutex.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: proto.AuctionServer_ServiceDesc.ServiceName})
+	return err == nil && reply.Status == healthpb.HealthCheckResponse_SERVING
+}
+
+func (h *harness) admin(i int) proto.AuctionAdminClient {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.nodes[h.addrs[i]].admin
+}
+
+func (h *harness) server(i int) *AuctionServer {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.nodes[h.addrs[i]].server
+}
+
+// waitLeader waits until one of the given replicas (all of them if none are
+// given) leads the highest term among them, and returns its index.
+func (h *harness) waitLeader(among ...int) int {
+	h.t.Helper()
+	if len(among) == 0 {
+		for i := range h.addrs {
+			among = append(among, i)
+		}
+	}
+	found := -1
+	h.eventually("a leader is elected", func() bool {
+		found = -1
+		var top int64 = -1
+		for _, i := range among {
+			s := h.server(i)
+			s.mutex.Lock()
+			term, isLeader := s.term, s.role == leader
+			s.mutex.Unlock()
+			if term > top {
+				top, found = term, -1
+			}
+			if isLeader && term == top {
+				found = i
+			}
+		}
+		return found >= 0
+	})
+	return found
+}
+
+// eventually fails the test if cond does not hold within a few seconds.
+func (h *harness) eventually(what string, cond func() bool) {
+	h.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// register retries while no leader has been elected yet.
+func (h *harness) register(i int, name string) *proto.Credentials {
+	h.t.Helper()
+	var creds *proto.Credentials
+	h.eventually(name+" is registered", func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		var err error
+		creds, err = h.client(i).Register(ctx, &proto.Registration{Bidder: name})
+		if err != nil && status.Code(err) != codes.Unavailable && status.Code(err) != codes.DeadlineExceeded {
+			h.t.Fatalf("register %s: %v", name, err)
+		}
+		return err == nil
+	})
+	return creds
+}
+
+// bid sends a bid through replica i, retrying while the cluster has no
+// leader, and returns the answer.
+func (h *harness) bid(i int, req *proto.Amount, opts ...grpc.CallOption) string {
+	h.t.Helper()
+	var ack *proto.Ack
+	h.eventually(req.Bidder+"'s bid is answered", func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		var err error
+		ack, err = h.client(i).Bid(ctx, req, opts...)
+		if err != nil && status.Code(err) != codes.Unavailable && status.Code(err) != codes.DeadlineExceeded {
+			h.t.Fatalf("bid from %s: %v", req.Bidder, err)
+		}
+		return err == nil
+	})
+	return ack.Ack
+}
+
+// converged waits until every replica that is up has applied want for
+// auction. It looks at the replicas' own state, since Result always answers
+// from the leader.
+func (h *harness) converged(auction, wantBidder string, wantBid int64) {
+	h.t.Helper()
+	for i := range h.addrs {
+		h.mutex.Lock()
+		up := h.nodes[h.addrs[i]].up
+		h.mutex.Unlock()
+		if !up {
+			continue
+		}
+		h.eventually(fmt.Sprintf("replica %d has %s/%d", i, wantBidder, wantBid), func() bool {
+			s := h.server(i)
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			a, ok := s.auctions[auctionID(auction)]
+			return ok && a.highestBidder == wantBidder && a.highestBid == wantBid
+		})
+	}
+}
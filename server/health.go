@@ -0,0 +1,59 @@
+package main
+
+import (
+	proto "Replication/grpc"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// A replica reports SERVING on the standard health service only while it can
+// help decide bids: it is not recovering its state after a restart or being
+// drained, and it is in touch with a quorum. Clients skip the replicas that
+// are not serving.
+
+// newHealth starts out NOT_SERVING, the replica has not found a leader yet.
+func newHealth() *health.Server {
+	h := health.NewServer()
+	h.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	h.SetServingStatus(proto.AuctionServer_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	return h
+}
+
+// serving tells whether the replica should report SERVING. A leader has to
+// have heard from a quorum within an election timeout, a follower has to
+// know its leader.
+func (s *AuctionServer) serving() bool {
+	if s.asked != nil || s.recovering || s.draining {
+		return false
+	}
+	switch s.role {
+	case leader:
+		inTouch := 1
+		for _, peer := range s.peers {
+			if s.heard[peer] < electionTicks {
+				inTouch++
+			}
+		}
+		return inTouch >= s.quorum()
+	case follower:
+		return s.leader != ""
+	}
+	return false
+}
+
+// updateHealth tells the health service whether the replica is serving.
+// Call it with the mutex held.
+func (s *AuctionServer) updateHealth() {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if s.serving() {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	if status == s.healthStatus {
+		return
+	}
+	s.healthStatus = status
+	s.health.SetServingStatus("", status)
+	s.health.SetServingStatus(proto.AuctionServer_ServiceDesc.ServiceName, status)
+	s.logger.Info("health changed", "status", status.String())
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// nodeState is the role and term the replica's log records show. It is kept
+// apart from the replication state, since records are also written while
+// the mutex is held.
+type nodeState struct {
+	role role
+	term int64
+}
+
+// show makes the log records show the current role and term. Call it with
+// the mutex held whenever either changes.
+func (s *AuctionServer) show() {
+	s.shown.Store(&nodeState{role: s.role, term: s.term})
+}
+
+// nodeHandler adds the replica's role and term to every record.
+type nodeHandler struct {
+	slog.Handler
+	s *AuctionServer
+}
+
+func (h nodeHandler) Handle(ctx context.Context, r slog.Record) error {
+	if st := h.s.shown.Load(); st != nil {
+		r.AddAttrs(slog.String("role", st.role.String()), slog.Int64("term", st.term))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h nodeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return nodeHandler{h.Handler.WithAttrs(attrs), h.s}
+}
+
+func (h nodeHandler) WithGroup(name string) slog.Handler {
+	return nodeHandler{h.Handler.WithGroup(name), h.s}
+}
+
+// newLogger logs through the default logger's handler, which main sets up
+// from the flags, and names the replica on every record.
+func (s *AuctionServer) newLogger() *slog.Logger {
+	return slog.New(nodeHandler{slog.Default().Handler(), s}).With("node", s.id)
+}
+
+// logCalls logs every call with how it ended, at debug level.
+func (s *AuctionServer) logCalls(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	reply, err := handler(ctx, req)
+	s.logger.DebugContext(ctx, "call", "method", info.FullMethod, "code", status.Code(err).String(), "took", time.Since(start))
+	return reply, err
+}
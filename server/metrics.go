@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"Replication/money"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics are the replica's Prometheus metrics. Every replica has a
+// registry of its own, so the tests can run several in one process.
+type metrics struct {
+	registry            *prometheus.Registry
+	bids                *prometheus.CounterVec
+	results             *prometheus.CounterVec
+	replication         *prometheus.HistogramVec
+	replicationFailures *prometheus.CounterVec
+	webhooks            *prometheus.CounterVec
+}
+
+func newMetrics(s *AuctionServer) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		bids: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auction_bids_total",
+			Help: "Bids this replica decided on, by outcome: accepted, too_low, closed, not_found, unauthenticated, wrong_currency, invalid, permission_denied, rate_limited or not_committed.",
+		}, []string{"outcome"}),
+		results: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auction_result_calls_total",
+			Help: "Result calls this replica answered, by gRPC code.",
+		}, []string{"code"}),
+		replication: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "auction_replication_seconds",
+			Help:    "Time replication calls to the other replicas took to succeed.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 12),
+		}, []string{"peer", "method"}),
+		replicationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auction_replication_failures_total",
+			Help: "Replication calls to the other replicas that failed.",
+		}, []string{"peer", "method"}),
+		webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auction_webhook_calls_total",
+			Help: "Webhook calls the leader made, by outcome: delivered, failed or given_up.",
+		}, []string{"outcome"}),
+	}
+	m.registry.MustRegister(m.bids, m.results, m.replication, m.replicationFailures, m.webhooks, stateCollector{s})
+	return m
+}
+
+// handler serves the metrics on /metrics.
+func (m *metrics) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+func (m *metrics) countBid(outcome string) {
+	m.bids.WithLabelValues(outcome).Inc()
+}
+
+// bidOutcome names the outcome of applying a bid.
+func bidOutcome(ack string) string {
+	switch ack {
+	case "success":
+		return "accepted"
+	case "fail":
+		return "closed"
+	}
+	return "too_low"
+}
+
+// observe records how a replication call to peer went.
+func (m *metrics) observe(peer, method string, took time.Duration, err error) {
+	if err != nil {
+		m.replicationFailures.WithLabelValues(peer, method).Inc()
+		return
+	}
+	m.replication.WithLabelValues(peer, method).Observe(took.Seconds())
+}
+
+var (
+	highestBidDesc  = prometheus.NewDesc("auction_highest_bid", "Highest bid of each auction on this replica, in whole units of its currency.", []string{"auction", "currency", "closed"}, nil)
+	lamportDesc     = prometheus.NewDesc("auction_lamport_time", "The replica's Lamport clock.", nil, nil)
+	leaderDesc      = prometheus.NewDesc("auction_leader", "1 if this replica is the leader, else 0.", nil, nil)
+	termDesc        = prometheus.NewDesc("auction_term", "The replica's current term.", nil, nil)
+	commitIndexDesc = prometheus.NewDesc("auction_commit_index", "Index of the last committed log entry.", nil, nil)
+	appliedDesc     = prometheus.NewDesc("auction_applied_index", "Index of the last applied log entry.", nil, nil)
+	lagDesc         = prometheus.NewDesc("auction_replication_lag", "Log entries the leader has that a peer has not confirmed. Only the leader reports it.", []string{"peer"}, nil)
+)
+
+// stateCollector reads the gauges from the replica's state at every scrape.
+type stateCollector struct {
+	s *AuctionServer
+}
+
+func (c stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{highestBidDesc, lamportDesc, leaderDesc, termDesc, commitIndexDesc, appliedDesc, lagDesc} {
+		ch <- d
+	}
+}
+
+func (c stateCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.s
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, a := range s.auctions {
+		closed := "false"
+		if a.isAuctionOver {
+			closed = "true"
+		}
+		bid := float64(a.highestBid) / math.Pow10(money.Digits(a.currency))
+		ch <- prometheus.MustNewConstMetric(highestBidDesc, prometheus.GaugeValue, bid, id, a.currency, closed)
+	}
+	ch <- prometheus.MustNewConstMetric(lamportDesc, prometheus.GaugeValue, float64(s.lamportTime))
+	isLeader := 0.0
+	if s.role == leader {
+		isLeader = 1
+	}
+	ch <- prometheus.MustNewConstMetric(leaderDesc, prometheus.GaugeValue, isLeader)
+	ch <- prometheus.MustNewConstMetric(termDesc, prometheus.GaugeValue, float64(s.term))
+	ch <- prometheus.MustNewConstMetric(commitIndexDesc, prometheus.GaugeValue, float64(s.commitIndex))
+	ch <- prometheus.MustNewConstMetric(appliedDesc, prometheus.GaugeValue, float64(s.lastApplied))
+	if s.role == leader {
+		for _, peer := range s.peers {
+			ch <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, float64(s.lastIndex()-s.matchIndex[peer]), peer)
+		}
+	}
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	proto "Replication/grpc"
+	"Replication/security"
+	"Replication/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The replicas agree on the order of bids with a small version of Raft: one
+// of them is elected leader, appends every bid to its log and sends the log to
+// the others. An entry is applied once a majority has stored it, so every
+// replica applies the same bids in the same order.
+
+const (
+	tickInterval   = 50 * time.Millisecond
+	heartbeatTicks = 2  // the leader sends heartbeats every 100ms
+	electionTicks  = 10 // followers wait 500-1000ms before starting an election
+	maxBatch       = 100
+	rpcTimeout     = 300 * time.Millisecond
+)
+
+var tracer = tracing.Tracer("Replication/server")
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+func (r role) String() string {
+	switch r {
+	case candidate:
+		return "candidate"
+	case leader:
+		return "leader"
+	}
+	return "follower"
+}
+
+var (
+	errNotLeader      = errors.New("this replica is not the leader")
+	errLostLeadership = errors.New("leadership changed before the bid was committed")
+	errRecovering     = errors.New("this replica has just started and does not know the current term yet")
+)
+
+// waiter is a client request waiting for its log entry to be applied.
+type waiter struct {
+	term int64
+	ch   chan string
+	span trace.SpanContext // the request's span, which replicating the entry joins
+}
+
+// replicaServer exposes the Replica service of an AuctionServer. It is its own
+// type because a struct cannot embed two Unimplemented servers.
+type replicaServer struct {
+	proto.UnimplementedReplicaServer
+	s *AuctionServer
+}
+
+func (r *replicaServer) RequestVote(ctx context.Context, req *proto.VoteRequest) (*proto.VoteReply, error) {
+	return r.s.handleVote(req), nil
+}
+
+func (r *replicaServer) AppendEntries(ctx context.Context, req *proto.AppendRequest) (*proto.AppendReply, error) {
+	reply, err := r.s.handleAppend(req)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return reply, nil
+}
+
+func (r *replicaServer) InstallSnapshot(ctx context.Context, req *proto.SnapshotRequest) (*proto.AppendReply, error) {
+	reply, err := r.s.handleSnapshot(req)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return reply, nil
+}
+
+// replicaOnly keeps clients away from the Replica service. With TLS on, only
+// callers with a certificate signed by the replicas' CA may use it.
+func replicaOnly(tlsEnabled bool) grpc.UnaryServerInterceptor {
+	prefix := "/" + proto.Replica_ServiceDesc.ServiceName + "/"
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if tlsEnabled && strings.HasPrefix(info.FullMethod, prefix) {
+			if err := security.RequireReplica(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// run drives elections and heartbeats until the server is stopped.
+func (s *AuctionServer) run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.tick()
+		}
+	}
+}
+
+func (s *AuctionServer) tick() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	defer s.updateHealth()
+
+	s.elapsed++
+	if s.role == leader {
+		for _, peer := range s.peers {
+			s.heard[peer]++
+		}
+		if s.elapsed >= heartbeatTicks {
+			s.elapsed = 0
+			s.broadcastAppend()
+		}
+		s.closeExpired()
+		return
+	}
+	if s.asked != nil {
+		s.askTerm()
+		return
+	}
+	if s.elapsed >= s.timeout && !s.recovering && !s.draining {
+		s.campaign()
+	}
+}
+
+// A replica started with -store memory, or with an empty store, has
+// forgotten its term, its vote and its log after a restart. Until it has
+// heard the current term from enough of the others it neither takes entries
+// nor campaigns, or a deposed leader could use it to overwrite committed
+// entries. After that it neither votes nor campaigns until it has caught up
+// with a leader, as a committed entry may be on no other majority. This
+// keeps the cluster safe as long as only one replica at a time is without
+// its state. A replica that loads saved state from its store skips all this.
+
+// termQuorum is how many of the other replicas a restarted replica has to
+// hear from. Every majority that stored a committed entry includes one of
+// them, even if the restarted replica was part of it and forgot.
+func (s *AuctionServer) termQuorum() int {
+	return len(s.peers) + 2 - s.quorum()
+}
+
+// askTerm asks the replicas that have not answered yet for their term. The
+// question is a RequestVote for term 0, which no candidate uses.
+func (s *AuctionServer) askTerm() {
+	for _, peer := range s.peers {
+		if s.asked[peer] {
+			continue
+		}
+		s.transport.RequestVote(peer, &proto.VoteRequest{Candidate: s.id}, func(reply *proto.VoteReply) {
+			s.handleTermReply(peer, reply)
+		})
+	}
+}
+
+func (s *AuctionServer) handleTermReply(peer string, reply *proto.VoteReply) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.asked == nil {
+		return
+	}
+	if reply.Term > s.term {
+		s.becomeFollower(reply.Term, "")
+	}
+	s.asked[peer] = true
+	if reply.LastLogIndex > 0 {
+		s.behind = true
+	}
+	if len(s.asked) >= s.termQuorum() {
+		s.asked = nil
+		if !s.behind {
+			// too few of the others have entries for any to be committed;
+			// there is nothing to catch up with
+			s.recovering = false
+		}
+		s.logger.Info("learned the term", "recovering", s.recovering)
+	}
+}
+
+func (s *AuctionServer) lastIndex() int64 {
+	return s.base() + int64(len(s.log)-1)
+}
+
+func (s *AuctionServer) quorum() int {
+	return (len(s.peers)+1)/2 + 1
+}
+
+func (s *AuctionServer) resetElectionTimer() {
+	s.elapsed = 0
+	s.timeout = electionTicks + s.rand.Intn(electionTicks)
+}
+
+func (s *AuctionServer) becomeFollower(term int64, leaderID string) {
+	if term > s.term {
+		s.term = term
+		s.votedFor = ""
+		s.saveState()
+	}
+	wasLeader := s.role == leader
+	s.role = follower
+	s.leader = leaderID
+	s.resetElectionTimer()
+	s.show()
+	if wasLeader {
+		s.logger.Info("stepped down")
+	}
+}
+
+func (s *AuctionServer) campaign() {
+	s.role = candidate
+	s.term++
+	s.votedFor = s.id
+	s.saveState()
+	s.votes = 1
+	s.leader = ""
+	s.resetElectionTimer()
+	s.show()
+	s.logger.Info("started an election")
+
+	if s.votes >= s.quorum() {
+		s.becomeLeader()
+		return
+	}
+	req := &proto.VoteRequest{
+		Term:         s.term,
+		Candidate:    s.id,
+		LastLogIndex: s.lastIndex(),
+		LastLogTerm:  s.entry(s.lastIndex()).Term,
+	}
+	for _, peer := range s.peers {
+		s.transport.RequestVote(peer, req, func(reply *proto.VoteReply) {
+			s.handleVoteReply(req, reply)
+		})
+	}
+}
+
+func (s *AuctionServer) handleVoteReply(req *proto.VoteRequest, reply *proto.VoteReply) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if reply.Term > s.term {
+		s.becomeFollower(reply.Term, "")
+		return
+	}
+	if s.role != candidate || s.term != req.Term || !reply.Granted {
+		return
+	}
+	s.votes++
+	if s.votes >= s.quorum() {
+		s.becomeLeader()
+	}
+}
+
+func (s *AuctionServer) becomeLeader() {
+	s.role = leader
+	s.show()
+	s.logger.Info("became the leader")
+	s.recovering = false
+	s.leader = s.id
+	s.elapsed = 0
+	s.closing = make(map[string]bool)
+	s.attempts = make(map[string]*attempt)
+	for _, peer := range s.peers {
+		s.nextIndex[peer] = s.lastIndex() + 1
+		s.matchIndex[peer] = 0
+		s.heard[peer] = 0
+	}
+	// entries from earlier terms only count as committed once an entry of
+	// the current term is, so start the term with a no-op
+	s.appendEntry(&proto.Entry{})
+}
+
+func (s *AuctionServer) handleVote(req *proto.VoteRequest) *proto.VoteReply {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if req.Term == 0 {
+		// a restarted replica asking for the term, see askTerm
+		return &proto.VoteReply{Term: s.term, LastLogIndex: s.lastIndex()}
+	}
+
+	if req.Term > s.term {
+		s.becomeFollower(req.Term, "")
+	}
+	lastTerm := s.entry(s.lastIndex()).Term
+	upToDate := req.LastLogTerm > lastTerm ||
+		(req.LastLogTerm == lastTerm && req.LastLogIndex >= s.lastIndex())
+
+	// a replica that has lost its state does not vote, see askTerm
+	granted := req.Term == s.term && upToDate && !s.recovering &&
+		(s.votedFor == "" || s.votedFor == req.Candidate)
+	if granted {
+		s.votedFor = req.Candidate
+		s.saveState()
+		s.resetElectionTimer()
+	}
+	return &proto.VoteReply{Term: s.term, Granted: granted}
+}
+
+// propose appends an entry to the leader's log and waits until it has been
+// applied, returning the outcome of applying it.
+func (s *AuctionServer) propose(ctx context.Context, entry *proto.Entry) (string, error) {
+	ctx, span := tracer.Start(ctx, "propose")
+	defer span.End()
+	index, ch, err := s.submit(ctx, entry)
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case ack, ok := <-ch:
+		if !ok {
+			span.SetStatus(otelcodes.Error, errLostLeadership.Error())
+			return "", errLostLeadership
+		}
+		span.SetAttributes(attribute.Int64("index", index), attribute.String("ack", ack))
+		return ack, nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		delete(s.waiting, index)
+		s.mutex.Unlock()
+		return "", ctx.Err()
+	}
+}
+
+// submit appends an entry to the leader's log. The channel receives the
+// outcome of applying it, or is closed if the entry is lost. The calls that
+// replicate the entry are traced as part of the span in ctx.
+func (s *AuctionServer) submit(ctx context.Context, entry *proto.Entry) (int64, chan string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.role != leader {
+		return 0, nil, errNotLeader
+	}
+	// wait before appending, a single replica commits the entry right away
+	index := s.lastIndex() + 1
+	ch := make(chan string, 1)
+	s.waiting[index] = waiter{term: s.term, ch: ch, span: trace.SpanContextFromContext(ctx)}
+	s.appendEntry(entry)
+	return index, ch, nil
+}
+
+// appendEntry adds an entry to the leader's log, sends it to the followers
+// and returns its index.
+func (s *AuctionServer) appendEntry(entry *proto.Entry) int64 {
+	entry.Term = s.term
+	entry.Time = s.clock.Now().UnixNano()
+	entry.PrevHash = s.hashAt(s.lastIndex())
+	s.log = append(s.log, entry)
+	s.saveEntries(entry)
+	s.maybeCommit()
+	s.broadcastAppend()
+	return s.lastIndex()
+}
+
+func (s *AuctionServer) broadcastAppend() {
+	for _, peer := range s.peers {
+		s.sendAppend(peer)
+	}
+}
+
+func (s *AuctionServer) appendRequest(peer string) *proto.AppendRequest {
+	next := s.nextIndex[peer]
+	end := min(s.lastIndex()+1, next+maxBatch)
+	return &proto.AppendRequest{
+		Term:         s.term,
+		Leader:       s.id,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  s.entry(next - 1).Term,
+		PrevLogHash:  s.hashAt(next - 1),
+		Entries:      append([]*proto.Entry(nil), s.log[next-s.base():end-s.base()]...),
+		LeaderCommit: s.commitIndex,
+	}
+}
+
+// sendAppend sends a peer the entries it is missing, or the snapshot if the
+// log no longer has them.
+func (s *AuctionServer) sendAppend(peer string) {
+	if s.nextIndex[peer] <= s.base() {
+		s.sendSnapshot(peer)
+		return
+	}
+	req := s.appendRequest(peer)
+	s.transport.AppendEntries(s.appendContext(req), peer, req, func(reply *proto.AppendReply) {
+		s.handleAppendReply(peer, req, reply)
+	})
+}
+
+// appendContext puts the call that sends req in the trace of the first
+// entry it carries that a client is waiting for. Heartbeats are not traced.
+func (s *AuctionServer) appendContext(req *proto.AppendRequest) context.Context {
+	for i := range req.Entries {
+		if w, ok := s.waiting[req.PrevLogIndex+1+int64(i)]; ok && w.span.IsValid() {
+			return trace.ContextWithSpanContext(context.Background(), w.span)
+		}
+	}
+	return context.Background()
+}
+
+func (s *AuctionServer) handleAppendReply(peer string, req *proto.AppendRequest, reply *proto.AppendReply) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if reply.Term > s.term {
+		s.becomeFollower(reply.Term, "")
+		return
+	}
+	if s.role != leader || s.term != req.Term {
+		return
+	}
+	s.heard[peer] = 0
+
+	if reply.HashMismatch > 0 {
+		// the follower will not take entries until it is restarted
+		s.noteMismatch(reply.HashMismatch, peer, "the replica's chain differs from the leader's")
+		return
+	}
+	if !reply.Success {
+		// a follower that restarted without its log has lost the entries it
+		// had matched; a stale matchIndex would also keep later successful
+		// replies below it from moving nextIndex on
+		s.matchIndex[peer] = min(s.matchIndex[peer], reply.LastLogIndex)
+		s.nextIndex[peer] = max(1, min(req.PrevLogIndex, reply.LastLogIndex+1))
+		s.sendAppend(peer)
+		return
+	}
+	match := req.PrevLogIndex + int64(len(req.Entries))
+	if match > s.matchIndex[peer] {
+		s.matchIndex[peer] = match
+		s.nextIndex[peer] = match + 1
+		s.maybeCommit()
+	}
+	if s.nextIndex[peer] <= s.lastIndex() {
+		s.sendAppend(peer)
+	}
+}
+
+func (s *AuctionServer) handleAppend(req *proto.AppendRequest) (*proto.AppendReply, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.asked != nil {
+		return nil, errRecovering
+	}
+	if req.Term < s.term {
+		return &proto.AppendReply{Term: s.term, LastLogIndex: s.lastIndex()}, nil
+	}
+	s.becomeFollower(req.Term, req.Leader)
+
+	if req.PrevLogIndex > s.lastIndex() {
+		return &proto.AppendReply{Term: s.term, LastLogIndex: s.lastIndex()}, nil
+	}
+	// req stays as it is, a duplicated request may arrive again
+	prevIndex, prevTerm, entries := req.PrevLogIndex, req.PrevLogTerm, req.Entries
+	if prevIndex < s.base() {
+		// the entries up to the snapshot are committed, so they match the
+		// leader's
+		skip := min(s.base()-prevIndex, int64(len(entries)))
+		entries = entries[skip:]
+		prevIndex, prevTerm = s.base(), s.entry(s.base()).Term
+	}
+	if s.entry(prevIndex).Term != prevTerm {
+		return &proto.AppendReply{Term: s.term, LastLogIndex: prevIndex - 1}, nil
+	}
+	if prevIndex == req.PrevLogIndex && s.hashAt(prevIndex) != req.PrevLogHash {
+		s.noteMismatch(prevIndex, req.Leader, "the entry differs from the leader's")
+		return &proto.AppendReply{Term: s.term, LastLogIndex: s.lastIndex(), HashMismatch: prevIndex}, nil
+	}
+
+	var appended []*proto.Entry
+	for i, entry := range entries {
+		index := prevIndex + 1 + int64(i)
+		if index <= s.lastIndex() {
+			if s.entry(index).Term == entry.Term {
+				continue
+			}
+			s.truncate(index)
+		}
+		if entry.PrevHash != s.hashAt(index-1) {
+			s.saveEntries(appended...)
+			s.noteMismatch(index, req.Leader, "the leader's entry does not chain on to this replica's log")
+			return &proto.AppendReply{Term: s.term, LastLogIndex: s.lastIndex(), HashMismatch: index}, nil
+		}
+		s.log = append(s.log, entry)
+		appended = append(appended, entry)
+	}
+	s.saveEntries(appended...)
+
+	if req.LeaderCommit > s.commitIndex {
+		// a stale request must not take back what is known to be committed
+		s.commitIndex = max(s.commitIndex, min(req.LeaderCommit, prevIndex+int64(len(entries))))
+		s.applyCommitted()
+	}
+	if s.lastIndex() >= req.LeaderCommit {
+		s.recovering = false
+	}
+	return &proto.AppendReply{Term: s.term, Success: true, LastLogIndex: s.lastIndex()}, nil
+}
+
+// truncate drops the uncommitted entries from index onwards, which a new
+// leader has replaced with its own.
+func (s *AuctionServer) truncate(index int64) {
+	for i := index; i <= s.lastIndex(); i++ {
+		if w, ok := s.waiting[i]; ok {
+			close(w.ch)
+			delete(s.waiting, i)
+		}
+	}
+	s.log = s.log[:index-s.base()]
+	s.saved(s.store.Truncate(index))
+}
+
+func (s *AuctionServer) maybeCommit() {
+	for n := s.lastIndex(); n > s.commitIndex; n-- {
+		if s.entry(n).Term != s.term {
+			break
+		}
+		count := 1
+		for _, peer := range s.peers {
+			if s.matchIndex[peer] >= n {
+				count++
+			}
+		}
+		if count >= s.quorum() {
+			s.commitIndex = n
+			s.applyCommitted()
+			return
+		}
+	}
+}
+
+func (s *AuctionServer) applyCommitted() {
+	for s.lastApplied < s.commitIndex {
+		s.lastApplied++
+		entry := s.entry(s.lastApplied)
+		ack := s.apply(entry)
+
+		if w, ok := s.waiting[s.lastApplied]; ok {
+			delete(s.waiting, s.lastApplied)
+			if w.term == entry.Term {
+				w.ch <- ack
+			} else {
+				close(w.ch)
+			}
+		}
+	}
+}
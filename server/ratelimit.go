@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	proto "Replication/grpc"
+	"Replication/security"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// forwardedFor carries the address of the original caller when a follower
+// passes a request on to the leader.
+const forwardedFor = "x-forwarded-for"
+
+// forwardedBy carries the replica that got a request from a client, when
+// it is passed on to the leader.
+const forwardedBy = "x-forwarded-by"
+
+// maxBuckets is how many callers a limiter tracks before it forgets the ones
+// that have been quiet long enough to have a full bucket again.
+const maxBuckets = 10000
+
+// limiter hands out tokens per key from buckets that refill at rate tokens
+// per second, up to burst.
+type limiter struct {
+	mutex   sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter returns nil, meaning no limit, if rate is not positive.
+func newLimiter(rate float64, burst int) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *limiter) allow(key string, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (l *limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limitRate enforces the per-bidder and per-address limits. Only the leader
+// counts, since every bid and registration goes through it no matter which
+// replica the client picked, so spreading requests over the replicas does
+// not get around the limits.
+func (s *AuctionServer) limitRate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if info.FullMethod != proto.AuctionServer_Bid_FullMethodName && info.FullMethod != proto.AuctionServer_Register_FullMethodName {
+		return handler(ctx, req)
+	}
+
+	s.mutex.Lock()
+	isLeader := s.role == leader
+	s.mutex.Unlock()
+	if !isLeader {
+		return handler(ctx, req)
+	}
+
+	now := time.Now()
+	_, isBid := req.(*proto.Amount)
+	if addr := s.sourceAddress(ctx); addr != "" && !s.addrLimit.allow(addr, now) {
+		if isBid {
+			s.metrics.countBid("rate_limited")
+		}
+		return nil, status.Errorf(codes.ResourceExhausted, "too many requests from %s", addr)
+	}
+	if bid, ok := req.(*proto.Amount); ok && !s.bidLimit.allow(bid.Bidder, now) {
+		s.metrics.countBid("rate_limited")
+		return nil, status.Errorf(codes.ResourceExhausted, "too many bids from %s", bid.Bidder)
+	}
+	return handler(ctx, req)
+}
+
+// sourceAddress is the IP of whoever sent a request. For requests passed on
+// by a follower it is the address the follower got it from.
+func (s *AuctionServer) sourceAddress(ctx context.Context) string {
+	if s.fromReplica(ctx) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(forwardedFor); len(values) > 0 {
+				return values[0]
+			}
+		}
+	}
+	return peerHost(ctx)
+}
+
+// peerHost is the host the caller is connected from.
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// receivedBy is the replica a client sent a request to: this one, or the
+// follower that passed it on.
+func (s *AuctionServer) receivedBy(ctx context.Context) string {
+	if s.fromReplica(ctx) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(forwardedBy); len(values) > 0 {
+				return values[0]
+			}
+		}
+	}
+	return s.id
+}
+
+// fromReplica tells if the caller has shown it is a replica. In a cluster
+// without TLS or tokens nobody can, so only callers on a replica's host are
+// believed; a client on the same host as a replica can still pose as one.
+func (s *AuctionServer) fromReplica(ctx context.Context) bool {
+	if s.insecure {
+		return s.peerHosts[peerHost(ctx)]
+	}
+	if claims, ok := security.ClaimsFromContext(ctx); ok {
+		return claims.Role == security.RoleReplica
+	}
+	return security.RequireReplica(ctx) == nil
+}
+
+// replicaHosts returns the hosts the replicas at addrs call from. A replica
+// given by port only runs on this machine and calls from a loopback address.
+func replicaHosts(addrs []string) map[string]bool {
+	hosts := make(map[string]bool)
+	for _, addr := range addrs {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			hosts[addr] = true
+			continue
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		hosts[host] = true
+		if ips, err := net.LookupHost(host); err == nil {
+			for _, ip := range ips {
+				hosts[ip] = true
+			}
+		}
+	}
+	return hosts
+}
+
+// forwardSource is used on the connections to the other replicas. When a
+// request is passed on to the leader it tells the leader where it came from
+// and which replica got it.
+func (s *AuctionServer) forwardSource(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if addr := s.sourceAddress(ctx); addr != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, forwardedFor, addr)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, forwardedBy, s.receivedBy(ctx))
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
@@ -2,81 +2,247 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
+	"log/slog"
+	"math/rand"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"Replication/faults"
 	proto "Replication/grpc"
+	"Replication/logging"
+	"Replication/security"
+	"Replication/tracing"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
 type AuctionServer struct {
 	proto.UnimplementedAuctionServerServer
-	highestBid    int
-	highestBidder string
-	bidders       map[string]bool
-	isAuctionOver bool
-	mutex         sync.Mutex
-	reps          []string
-	port          string
-	highestTS     int32
-	lamportTime   int32
+	auctions    map[string]*auction
+	bidders     map[string]string // bidder name -> hash of its token
+	mutex       sync.Mutex
+	port        string
+	lamportTime int32
+	signer      *security.Signer // nil when bearer tokens are not required
+	insecure    bool             // no TLS or tokens, so replicas are told apart by host only
+	peerHosts   map[string]bool  // hosts the other replicas call from, see fromReplica
+	bidLimit    *limiter         // per bidder, nil for no limit
+	addrLimit   *limiter         // per source address, nil for no limit
+
+	// replication state, see raft.go
+	id          string
+	peers       []string
+	conns       map[string]*grpc.ClientConn
+	role        role
+	term        int64
+	votedFor    string
+	leader      string
+	votes       int
+	log         []*proto.Entry  // log[0] stands for the snapshot, or is a placeholder so indices start at 1
+	snapshot    *proto.Snapshot // nil until the log is first compacted, see snapshot.go
+	commitIndex int64
+	lastApplied int64
+	nextIndex   map[string]int64
+	matchIndex  map[string]int64
+	elapsed     int
+	timeout     int
+	waiting     map[int64]waiter
+	closing     map[string]bool                 // auctions the leader has already sent a close for
+	asked       map[string]bool                 // replicas that told their term since the start, nil once enough did
+	behind      bool                            // one of the replicas that told their term has entries
+	recovering  bool                            // started without state and not caught up with a leader yet
+	heard       map[string]int                  // ticks since each replica last answered the leader
+	draining    bool                            // turning clients away and not campaigning, see admin.go
+	watchers    map[*watcher]bool               // streams of Watch calls, see events.go
+	webhooks    map[string]*proto.Webhook       // by URL, see webhooks.go
+	deliveries  []*proto.Delivery               // webhook calls not done yet, in the order they came up
+	attempts    map[string]*attempt             // how the leader's webhook calls went, by event ID and URL
+	trails      map[string][]*proto.AuditRecord // audit trail of every auction, see audit.go
+	mismatch    *proto.LedgerReport             // first hash chain mismatch found while replicating, see chain.go
+	store       Store                           // where the term, vote, log and snapshot are saved, see store.go
+	done        chan struct{}
+
+	clock     Clock
+	transport Transport
+	rand      Rand
+
+	logger       *slog.Logger
+	shown        atomic.Pointer[nodeState]
+	metrics      *metrics
+	health       *health.Server
+	healthStatus healthpb.HealthCheckResponse_ServingStatus // what health last reported, see health.go
 }
 
 const auctionDuration = 1000 * time.Second
 
-var port = flag.String("port", "50051", "Server port")
+var (
+	port      = flag.String("port", "50051", "Server port")
+	logFile   = flag.String("log-file", "-", "File to append the log to, - for standard error")
+	logFormat = flag.String("log-format", "text", "Log format, text or json")
+	logLevel  = flag.String("log-level", "info", "Least level to log: debug, info, warn or error")
+
+	traceExporter = flag.String("trace", "", "Where to send traces: stdout or otlp. Off if empty")
+	otlpEndpoint  = flag.String("otlp-endpoint", "localhost:4317", "OTLP gRPC endpoint to send traces to with -trace otlp")
+	metricsAddr   = flag.String("metrics-addr", "", "Address to serve Prometheus metrics on at /metrics, e.g. :9051. Off if empty")
+	cluster       = flag.String("cluster", ":50051,:50052,:50053", "Comma-separated addresses of all the replicas, including this one")
+
+	certFile   = flag.String("cert", "", "TLS certificate of this replica, also used as client certificate towards the other replicas")
+	keyFile    = flag.String("key", "", "TLS key of this replica")
+	caFile     = flag.String("ca", "", "CA that signed the replica certificates")
+	serverName = flag.String("server-name", "localhost", "Name in the other replicas' certificates")
+	tokenKey   = flag.String("token-key", "", "Key for signing bearer tokens, shared by all replicas. Turns on token authentication")
+
+	bidRate   = flag.Float64("bid-rate", 5, "Bids per second allowed per bidder, 0 for no limit")
+	bidBurst  = flag.Int("bid-burst", 10, "Bids a bidder may send at once before -bid-rate applies")
+	addrRate  = flag.Float64("addr-rate", 20, "Bids and registrations per second allowed per source address, 0 for no limit")
+	addrBurst = flag.Int("addr-burst", 40, "Requests an address may send at once before -addr-rate applies")
+
+	faultInjection = flag.Bool("fault-injection", false, "Offer the Faults service, which makes calls to the other replicas fail or lag on purpose")
+	faultsFile     = flag.String("faults", "", "JSON file with fault rules to start with, turns on -fault-injection")
+
+	storeKind = flag.String("store", "memory", "Where to save the log: memory, file or bolt. Only file and bolt keep it across restarts")
+	storePath = flag.String("store-path", "", "File for -store file or bolt, by default auction-<port>.log or auction-<port>.db")
+)
 
 func main() {
+	flag.Parse()
+
 	// do it for the log
-	file, err := os.OpenFile("../auction_log.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	logger, closeLog, err := logging.Config{File: *logFile, Format: *logFormat, Level: *logLevel}.Logger()
 	if err != nil {
-		log.Fatalf("failed to open log file: %v", err)
+		log.Fatalf("Failed to set up the log: %v", err)
 	}
-	defer file.Close()
+	defer closeLog()
+	slog.SetDefault(logger)
 
-	log.SetOutput(file)
+	// heartbeats and term probes would each be a trace of their own
+	stopTracing, err := tracing.Config{
+		Exporter:  *traceExporter,
+		Endpoint:  *otlpEndpoint,
+		Service:   "auction-server",
+		Instance:  ":" + *port,
+		SkipRoots: []string{"proto.Replica/"},
+	}.Setup()
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer stopTracing(context.Background())
 
 	// handle 'crashing' for the log
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
-	flag.Parse()
-
 	// actual main
-	log.Println("i want to start listening")
 	listener, err := net.Listen("tcp", ":"+*port)
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
-	log.Printf("Listener created successfully: %v", listener.Addr())
 
-	grpcServer := grpc.NewServer()
-	auctionServer := &AuctionServer{
-		highestBid:    0,
-		bidders:       make(map[string]bool),
-		isAuctionOver: false,
-		port:          *port,
-		highestTS:     0,
-		lamportTime:   0,
+	tlsFiles := security.TLSFiles{Cert: *certFile, Key: *keyFile, CA: *caFile, ServerName: *serverName}
+	if tlsFiles.Enabled() && (tlsFiles.Cert == "" || tlsFiles.Key == "" || tlsFiles.CA == "") {
+		log.Fatalf("TLS needs -cert, -key and -ca so the replicas can verify each other")
+	}
+	creds, err := tlsFiles.ServerOption()
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+	dialOpt, err := tlsFiles.DialOption()
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
 	}
-	proto.RegisterAuctionServerServer(grpcServer, auctionServer)
+	dialOpts := []grpc.DialOption{dialOpt}
 
-	go func() {
-		log.Println("Starting auction timer...")
-		auctionServer.AuctionTimer()
-		log.Println("Auction timer completed")
-	}()
+	var signer *security.Signer
+	if *tokenKey != "" {
+		signer, err = security.LoadSigner(*tokenKey)
+		if err != nil {
+			log.Fatalf("Failed to set up tokens: %v", err)
+		}
+		// the replicas call each other with a token of their own
+		replicaToken, err := signer.Issue(":"+*port, security.RoleReplica, 0)
+		if err != nil {
+			log.Fatalf("Failed to issue replica token: %v", err)
+		}
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(security.NewBearerToken(replicaToken)))
+	}
+	auth := authorizer{signer: signer}
+
+	var injector *faults.Injector
+	if *faultInjection || *faultsFile != "" {
+		injector = faults.NewInjector(":"+*port, time.Now().UnixNano())
+		if *faultsFile != "" {
+			rules, err := faults.LoadRules(*faultsFile)
+			if err != nil {
+				log.Fatalf("Failed to load fault rules: %v", err)
+			}
+			injector.Set(rules)
+		}
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(injector.UnaryClientInterceptor()))
+		slog.Info("fault injection is on")
+	}
+
+	auctionServer, err := NewAuctionServer(":"+*port, strings.Split(*cluster, ","), dialOpts...)
+	if err != nil {
+		log.Fatalf("Failed to set up replication: %v", err)
+	}
+	auctionServer.port = *port
+	path := *storePath
+	switch {
+	case path != "":
+	case *storeKind == "file":
+		path = "auction-" + *port + ".log"
+	case *storeKind == "bolt":
+		path = "auction-" + *port + ".db"
+	}
+	store, err := openStore(*storeKind, path)
+	if err != nil {
+		log.Fatalf("Failed to open the store: %v", err)
+	}
+	defer store.Close()
+	if err := auctionServer.UseStore(store); err != nil {
+		log.Fatalf("Failed to load the store: %v", err)
+	}
+	auctionServer.signer = signer
+	auctionServer.insecure = !tlsFiles.Enabled() && signer == nil
+	auctionServer.bidLimit = newLimiter(*bidRate, *bidBurst)
+	auctionServer.addrLimit = newLimiter(*addrRate, *addrBurst)
+
+	grpcServer := grpc.NewServer(creds, tracing.ServerOption(),
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(), auctionServer.logCalls, replicaOnly(tlsFiles.Enabled()), auth.unary, auctionServer.refuseWhileDraining, auctionServer.limitRate),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(), auth.stream))
+	auctionServer.RegisterServices(grpcServer)
+	if injector != nil {
+		proto.RegisterFaultsServer(grpcServer, injector)
+	}
+	auctionServer.Start()
+
+	if *metricsAddr != "" {
+		go func() {
+			auctionServer.logger.Info("serving metrics", "addr", *metricsAddr)
+			if err := http.ListenAndServe(*metricsAddr, auctionServer.metrics.handler()); err != nil {
+				log.Fatalf("Failed to serve metrics: %v", err)
+			}
+		}()
+	}
 
 	go func() {
-		log.Printf("Server is running at %s", listener.Addr())
+		auctionServer.logger.Info("server is running", "addr", listener.Addr().String())
 		if err := grpcServer.Serve(listener); err != nil {
 			log.Fatalf("Failed to serve: %s", err)
 		}
@@ -84,92 +250,231 @@ func main() {
 
 	// logging the crash/interruption
 	<-stop
-	log.Printf("System interrupted. Shutting down server %v. \n", listener.Addr())
-	grpcServer.GracefulStop()
-	log.Printf("Server %v stopped... \n", listener.Addr())
+	auctionServer.logger.Info("interrupted, shutting down")
+	auctionServer.Stop()
+	// clients watching the health service never hang up by themselves
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		grpcServer.Stop()
+	}
+	auctionServer.logger.Info("server stopped")
 }
 
-func (s *AuctionServer) Bid(ctx context.Context, req *proto.Amount) (*proto.Ack, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	if s.isAuctionOver {
-		return &proto.Ack{
-			Ack: "fail",
-		}, nil
+// NewAuctionServer creates the replica with address id. cluster lists the
+// addresses of all replicas and may include id itself. dialOpts are used to
+// connect to the other replicas; without them the connections are insecure.
+func NewAuctionServer(id string, cluster []string, dialOpts ...grpc.DialOption) (*AuctionServer, error) {
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
 	}
 
-	s.lamportTime++
-	reqTS := req.Timestamp
-	if reqTS < s.lamportTime {
-		reqTS = s.lamportTime
+	s := newReplica(id, cluster, systemClock{}, nil, rand.New(rand.NewSource(time.Now().UnixNano())))
+	s.transport = grpcTransport{conns: s.conns, metrics: s.metrics}
+	s.peerHosts = replicaHosts(s.peers)
+	// reconnect to a restarted replica soon, instead of after up to two
+	// minutes; later options, like the tests', take precedence
+	dialOpts = append([]grpc.DialOption{grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff:           backoff.Config{BaseDelay: 100 * time.Millisecond, Multiplier: 1.6, Jitter: 0.2, MaxDelay: time.Second},
+		MinConnectTimeout: time.Second,
+	})}, dialOpts...)
+	dialOpts = append(dialOpts, tracing.DialOption(), grpc.WithChainUnaryInterceptor(s.forwardSource, logging.UnaryClientInterceptor()))
+	for _, addr := range s.peers {
+		conn, err := grpc.Dial(addr, dialOpts...)
+		if err != nil {
+			return nil, err
+		}
+		s.conns[addr] = conn
 	}
+	return s, nil
+}
 
-	if req.Amount > int32(s.highestBid) ||
-		(req.Amount == int32(s.highestBid) && (reqTS > s.highestTS ||
-			(reqTS == s.highestTS && req.Bidder < s.highestBidder))) {
-
-		s.highestBid = int(req.Amount)
-		s.highestBidder = req.Bidder
-		s.highestTS = reqTS
-		s.lamportTime = reqTS
-
-		// propagate the bid request to all replicas
-		s.PropagateBid(req)
+// newReplica creates a replica that reaches the outside world only through
+// clock, transport and random.
+func newReplica(id string, cluster []string, clock Clock, transport Transport, random Rand) *AuctionServer {
+	s := &AuctionServer{
+		auctions:    map[string]*auction{defaultAuction: {currency: defaultCurrency}},
+		bidders:     make(map[string]string),
+		lamportTime: 0,
+		id:          id,
+		conns:       make(map[string]*grpc.ClientConn),
+		log:         []*proto.Entry{{}},
+		nextIndex:   make(map[string]int64),
+		matchIndex:  make(map[string]int64),
+		heard:       make(map[string]int),
+		waiting:     make(map[int64]waiter),
+		closing:     make(map[string]bool),
+		watchers:    make(map[*watcher]bool),
+		webhooks:    make(map[string]*proto.Webhook),
+		attempts:    make(map[string]*attempt),
+		trails:      make(map[string][]*proto.AuditRecord),
+		store:       &memoryStore{},
+		done:        make(chan struct{}),
+		clock:       clock,
+		transport:   transport,
+		rand:        random,
 
-		return &proto.Ack{
-			Ack: "success",
-		}, nil
+		health:       newHealth(),
+		healthStatus: healthpb.HealthCheckResponse_NOT_SERVING,
 	}
+	for _, addr := range cluster {
+		addr = strings.TrimSpace(addr)
+		if addr != "" && addr != id {
+			s.peers = append(s.peers, addr)
+		}
+	}
+	if len(s.peers) > 0 {
+		s.asked = make(map[string]bool)
+		s.recovering = true
+	}
+	s.resetElectionTimer()
+	s.show()
+	s.logger = s.newLogger()
+	s.metrics = newMetrics(s)
+	return s
+}
 
-	return &proto.Ack{
-		Ack: "BidException: Your bid was too low ;(",
-	}, nil
-
+// RegisterServices adds the public auction service, the internal replication
+// service, the admin service and the health service to grpcServer.
+func (s *AuctionServer) RegisterServices(grpcServer *grpc.Server) {
+	proto.RegisterAuctionServerServer(grpcServer, s)
+	proto.RegisterReplicaServer(grpcServer, &replicaServer{s: s})
+	proto.RegisterAuctionAdminServer(grpcServer, &adminServer{s: s})
+	healthpb.RegisterHealthServer(grpcServer, s.health)
 }
 
-func (s *AuctionServer) PropagateBid(req *proto.Amount) {
-	for _, addr := range s.reps {
-		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		if err != nil {
-			log.Printf("Cannot connect to replica %v: %v", addr, err)
-			continue
-		}
-		defer conn.Close()
+// Start begins taking part in elections and starts the auction timer.
+func (s *AuctionServer) Start() {
+	go s.run()
+	go s.sendWebhooks()
+	go func() {
+		s.logger.Debug("auction timer started")
+		s.AuctionTimer()
+		s.logger.Debug("auction timer stopped")
+	}()
+}
 
-		client := proto.NewAuctionServerClient(conn)
-		_, err = client.Bid(context.Background(), req)
-		if err != nil {
-			log.Printf("Failed to propagate bid to replica %v: %v", addr, err)
-		}
+// Stop halts the replica's background work and closes its peer connections.
+func (s *AuctionServer) Stop() {
+	close(s.done)
+	s.health.Shutdown()
+	for _, conn := range s.conns {
 		conn.Close()
 	}
 }
 
-func (s *AuctionServer) Result(ctx context.Context, req *proto.Empty) (*proto.Outcome, error) {
+// checkBid refuses a bid whose fields are too long to go in the log.
+func checkBid(req *proto.Amount) error {
+	if err := checkName("bidder", req.Bidder); err != nil {
+		return err
+	}
+	if err := checkName("auction", req.Auction); err != nil {
+		return err
+	}
+	if len(req.Currency) > 3 {
+		return status.Errorf(codes.InvalidArgument, "%.10q is not a currency code", req.Currency)
+	}
+	return nil
+}
+
+func (s *AuctionServer) Bid(ctx context.Context, req *proto.Amount) (*proto.Ack, error) {
+	if claims, ok := security.ClaimsFromContext(ctx); ok && claims.Role == security.RoleBidder && claims.Subject != req.Bidder {
+		s.metrics.countBid("permission_denied")
+		return nil, status.Errorf(codes.PermissionDenied, "token of %s cannot bid as %s", claims.Subject, req.Bidder)
+	}
+	if err := checkBid(req); err != nil {
+		s.metrics.countBid("invalid")
+		return nil, err
+	}
+
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	a, ok := s.auctions[auctionID(req.Auction)]
+	over := ok && a.isAuctionOver
+	var currency string
+	if ok {
+		currency = a.currency
+	}
+	isLeader := s.role == leader
+	s.mutex.Unlock()
 
-	if s.isAuctionOver {
-		return &proto.Outcome{
-			Result:        "Auction over, the highest bidder was " + s.highestBidder,
-			HighestBid:    int32(s.highestBid),
-			HighestBidder: s.highestBidder,
+	// a follower may not have heard of a new auction yet, so only the
+	// leader's view counts
+	if !isLeader {
+		return s.forwardBid(ctx, req)
+	}
+	if !ok {
+		s.metrics.countBid("not_found")
+		return nil, status.Errorf(codes.NotFound, "no auction called %s", auctionID(req.Auction))
+	}
+	// anyone can make up a bidder, so bids are only logged once the bidder
+	// is known to be registered
+	if err := s.authenticate(req.Bidder, req.Token); err != nil {
+		s.metrics.countBid("unauthenticated")
+		if s.registered(req.Bidder) {
+			s.reject(s.receivedBy(ctx), req, "unauthenticated")
+		}
+		return nil, err
+	}
+	if over {
+		s.metrics.countBid("closed")
+		s.reject(s.receivedBy(ctx), req, "closed")
+		return &proto.Ack{
+			Ack: "fail",
 		}, nil
 	}
+	if req.Currency != "" && strings.ToUpper(req.Currency) != currency {
+		s.metrics.countBid("wrong_currency")
+		s.reject(s.receivedBy(ctx), req, "wrong_currency")
+		return nil, status.Errorf(codes.InvalidArgument, "auction %s takes bids in %s, not %s", auctionID(req.Auction), currency, req.Currency)
+	}
+
+	// the token has been checked, so it stays out of the log
+	bid := &proto.Amount{
+		Amount:    req.Amount,
+		Bidder:    req.Bidder,
+		Timestamp: req.Timestamp,
+		Auction:   auctionID(req.Auction),
+		Currency:  currency,
+	}
+	ack, err := s.propose(ctx, &proto.Entry{Replica: s.receivedBy(ctx), Op: &proto.Entry_Bid{Bid: bid}})
+	if errors.Is(err, errNotLeader) {
+		return s.forwardBid(ctx, req)
+	}
+	if err != nil {
+		s.metrics.countBid("not_committed")
+		s.logger.WarnContext(ctx, "bid not committed", "auction", bid.Auction, "bidder", bid.Bidder, "amount", bid.Amount, "err", err)
+		return nil, replicationError(err)
+	}
+	s.metrics.countBid(bidOutcome(ack))
+	s.logger.InfoContext(ctx, "bid", "auction", bid.Auction, "bidder", bid.Bidder, "amount", bid.Amount, "ack", ack)
 
-	return &proto.Outcome{
-		Result:        "Auction is ongoing, the highest bidder is " + s.highestBidder,
-		HighestBid:    int32(s.highestBid),
-		HighestBidder: s.highestBidder,
+	return &proto.Ack{
+		Ack: ack,
 	}, nil
+}
 
+// forwardBid passes a bid on to the leader, which decides its place in the
+// order of bids.
+func (s *AuctionServer) forwardBid(ctx context.Context, req *proto.Amount) (*proto.Ack, error) {
+	client, err := s.leaderClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Bid(ctx, req)
 }
 
-func (s *AuctionServer) AuctionTimer() {
-	time.Sleep(auctionDuration) // makes the auction run for an amount of time
+func (s *AuctionServer) leaderClient() (proto.AuctionServerClient, error) {
 	s.mutex.Lock()
-	s.isAuctionOver = true // ends auction
+	conn := s.conns[s.leader]
 	s.mutex.Unlock()
-	log.Println("Auction has ended")
+
+	if conn == nil {
+		return nil, status.Error(codes.Unavailable, "no leader has been elected yet")
+	}
+	return proto.NewAuctionServerClient(conn), nil
 }
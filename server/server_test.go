@@ -0,0 +1,1000 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"Replication/frontend"
+	proto "Replication/grpc"
+	"Replication/history"
+	"Replication/ledger"
+	"Replication/security"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestBidAcceptance(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	anna := h.register(0, "Anna").Token
+	karoline := h.register(1, "Karoline").Token
+
+	steps := []struct {
+		bidder string
+		token  string
+		amount int64
+		want   string
+	}{
+		{"Anna", anna, 50, "success"},
+		{"Karoline", karoline, 40, "BidException: Your bid was too low ;("},
+		{"Karoline", karoline, 50, "BidException: Your bid was too low ;("},
+		{"Karoline", karoline, 60, "success"},
+		{"Anna", anna, 60, "BidException: Your bid was too low ;("},
+	}
+	for i, step := range steps {
+		got := h.bid(i%3, &proto.Amount{Amount: step.amount, Bidder: step.bidder, Token: step.token})
+		if got != step.want {
+			t.Fatalf("step %d: %s bids %d: got %q, want %q", i, step.bidder, step.amount, got, step.want)
+		}
+	}
+	h.converged("", "Karoline", 60)
+}
+
+func TestEqualBidsConvergeOnOneWinner(t *testing.T) {
+	for round := 0; round < 3; round++ {
+		h := newHarness(t, 3, nil)
+
+		// Anna and Karoline bid the same amount at the same time through
+		// different replicas, with timestamps that would favour opposite
+		// winners under a per-replica clock
+		users := []struct {
+			name    string
+			replica int
+			ts      int32
+		}{
+			{"Anna", 0, 7},
+			{"Karoline", 2, 3},
+		}
+		tokens := make([]string, len(users))
+		for i, user := range users {
+			tokens[i] = h.register(1, user.name).Token
+		}
+
+		acks := make([]string, len(users))
+		var wg sync.WaitGroup
+		for i, user := range users {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				acks[i] = h.bid(user.replica, &proto.Amount{Amount: 100, Bidder: user.name, Timestamp: user.ts, Token: tokens[i]})
+			}()
+		}
+		wg.Wait()
+
+		successes := 0
+		winner := ""
+		for i, ack := range acks {
+			if ack == "success" {
+				successes++
+				winner = users[i].name
+			}
+		}
+		if successes != 1 {
+			t.Fatalf("round %d: want exactly one accepted bid, got acks %v", round, acks)
+		}
+
+		// every replica must report the same winner once it has caught up
+		h.converged("", winner, 100)
+	}
+}
+
+func TestBidsPropagateToRestartedReplica(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	leader := h.waitLeader()
+	follower := (leader + 1) % 3
+	token := h.register(leader, "Anna").Token
+
+	// the auction goes on with two out of three replicas
+	h.crash(follower)
+	if ack := h.bid(leader, &proto.Amount{Amount: 10, Bidder: "Anna", Token: token}); ack != "success" {
+		t.Fatalf("bid with one replica down: got %q", ack)
+	}
+
+	// the replica comes back empty and is caught up by the leader
+	h.start(follower)
+	h.converged("", "Anna", 10)
+	if ack := h.bid(follower, &proto.Amount{Amount: 20, Bidder: "Anna", Token: token}); ack != "success" {
+		t.Fatalf("bid through restarted replica: got %q", ack)
+	}
+	h.converged("", "Anna", 20)
+}
+
+func TestReplicaRestartedTwiceCatchesUp(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	leader := h.waitLeader()
+	follower := (leader + 1) % 3
+	token := h.register(leader, "Anna").Token
+
+	// the second time the leader needs more than one batch to catch the
+	// replica up from nothing, though it had matched more before
+	amount := int64(0)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < maxBatch; i++ {
+			amount++
+			if ack := h.bid(leader, &proto.Amount{Amount: amount, Bidder: "Anna", Token: token}); ack != "success" {
+				t.Fatalf("bid of %d: got %q", amount, ack)
+			}
+		}
+		h.converged("", "Anna", amount)
+		h.crash(follower)
+		h.start(follower)
+	}
+	h.converged("", "Anna", amount)
+}
+
+func TestLeaderCrashKeepsAcceptedBids(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	old := h.waitLeader()
+	token := h.register(old, "Anna").Token
+	if ack := h.bid(old, &proto.Amount{Amount: 10, Bidder: "Anna", Token: token}); ack != "success" {
+		t.Fatalf("first bid: got %q", ack)
+	}
+
+	h.crash(old)
+	rest := []int{(old + 1) % 3, (old + 2) % 3}
+	h.waitLeader(rest...)
+	if ack := h.bid(rest[0], &proto.Amount{Amount: 10, Bidder: "Anna", Token: token}); ack == "success" {
+		t.Fatal("new leader forgot the bid of 10")
+	}
+	if ack := h.bid(rest[1], &proto.Amount{Amount: 15, Bidder: "Anna", Token: token}); ack != "success" {
+		t.Fatalf("bid after failover: got %q", ack)
+	}
+	h.converged("", "Anna", 15)
+}
+
+func TestPartitionedLeaderCannotAcceptBids(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	old := h.waitLeader()
+	token := h.register(old, "Anna").Token
+	rest := []int{(old + 1) % 3, (old + 2) % 3}
+
+	h.partition([]int{old}, rest)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	_, err := h.client(old).Bid(ctx, &proto.Amount{Amount: 99, Bidder: "Anna", Token: token})
+	cancel()
+	if err == nil {
+		t.Fatal("leader cut off from the majority accepted a bid")
+	}
+
+	h.waitLeader(rest...)
+	if ack := h.bid(rest[0], &proto.Amount{Amount: 20, Bidder: "Anna", Token: token}); ack != "success" {
+		t.Fatalf("bid in the majority: got %q", ack)
+	}
+
+	// after healing the old leader drops the bid it never committed
+	h.heal()
+	h.converged("", "Anna", 20)
+}
+
+func TestHealthFollowsReplication(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	old := h.waitLeader()
+	all := func() bool { return h.serving(0) && h.serving(1) && h.serving(2) }
+	h.eventually("all replicas are serving", all)
+
+	// a restarted replica is not serving until it has caught up
+	follower := (old + 1) % 3
+	h.restart(follower)
+	s := h.server(follower)
+	s.mutex.Lock()
+	serving := s.serving()
+	s.mutex.Unlock()
+	if serving {
+		t.Fatal("restarted replica is serving before it caught up")
+	}
+	h.eventually("the restarted replica is serving", func() bool { return h.serving(follower) })
+
+	// a leader cut off from the others stops serving, the new one serves
+	rest := []int{(old + 1) % 3, (old + 2) % 3}
+	h.partition([]int{old}, rest)
+	h.eventually("the cut off leader is not serving", func() bool { return !h.serving(old) })
+	h.eventually("the new leader is serving", func() bool { return h.serving(h.waitLeader(rest...)) })
+
+	h.heal()
+	h.eventually("all replicas are serving after healing", all)
+}
+
+func TestSnapshotCatchesUpRestartedReplica(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	leader := h.waitLeader()
+	follower := (leader + 1) % 3
+	token := h.register(leader, "Anna").Token
+	h.bid(leader, &proto.Amount{Amount: 10, Bidder: "Anna", Token: token})
+
+	h.crash(follower)
+	h.bid(leader, &proto.Amount{Amount: 20, Bidder: "Anna", Token: token})
+	info, err := h.admin(leader).Snapshot(context.Background(), &proto.Empty{})
+	if err != nil || info.Compacted == 0 {
+		t.Fatalf("snapshot: got %v, %v", info, err)
+	}
+
+	// the leader no longer has the entries, so it sends the snapshot
+	h.start(follower)
+	h.converged("", "Anna", 20)
+	st, err := h.admin(follower).Status(context.Background(), &proto.Empty{})
+	if err != nil || st.SnapshotIndex != info.Index {
+		t.Fatalf("status of the restarted replica: got %v, %v, want snapshot index %d", st, err, info.Index)
+	}
+	if ack := h.bid(follower, &proto.Amount{Amount: 30, Bidder: "Anna", Token: token}); ack != "success" {
+		t.Fatalf("bid after the snapshot: got %q", ack)
+	}
+	h.converged("", "Anna", 30)
+}
+
+func TestAdminStatus(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	leader := h.waitLeader()
+	token := h.register(leader, "Anna").Token
+	h.bid(leader, &proto.Amount{Amount: 10, Bidder: "Anna", Token: token})
+
+	var st *proto.NodeStatus
+	h.eventually("the leader reaches both peers", func() bool {
+		var err error
+		st, err = h.admin(leader).Status(context.Background(), &proto.Empty{})
+		if err != nil {
+			t.Fatalf("status: %v", err)
+		}
+		return len(st.Peers) == 2 && st.Peers[0].Reachable && st.Peers[1].Reachable
+	})
+	if st.Role != "leader" || st.Leader != h.addrs[leader] || st.CommitIndex == 0 || st.AppliedIndex != st.CommitIndex || !st.Serving {
+		t.Errorf("status of the leader: %v", st)
+	}
+	if len(st.Auctions) != 1 || st.Auctions[0].HighestBidder != "Anna" || st.Auctions[0].HighestBid != 10 {
+		t.Errorf("auctions: %v", st.Auctions)
+	}
+}
+
+func TestStepDownAndDrain(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	old := h.waitLeader()
+	token := h.register(old, "Anna").Token
+
+	if _, err := h.admin((old+1)%3).StepDown(context.Background(), &proto.Empty{}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("step down of a follower: got %v", err)
+	}
+	if _, err := h.admin(old).StepDown(context.Background(), &proto.Empty{}); err != nil {
+		t.Fatalf("step down: %v", err)
+	}
+	next := h.waitLeader()
+	if next == old {
+		t.Fatal("the leader that stepped down was elected again")
+	}
+
+	// a drained leader steps down, turns clients away and stops serving
+	if _, err := h.admin(next).Drain(context.Background(), &proto.DrainRequest{}); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if _, err := h.client(next).Bid(context.Background(), &proto.Amount{Amount: 10, Bidder: "Anna", Token: token}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("bid to a draining replica: got %v", err)
+	}
+	third := 3 - old - next
+	if ack := h.bid(third, &proto.Amount{Amount: 10, Bidder: "Anna", Token: token}); ack != "success" {
+		t.Fatalf("bid while one replica drains: got %q", ack)
+	}
+	if leader := h.waitLeader(); leader == next {
+		t.Fatal("the draining replica leads")
+	}
+	h.eventually("the draining replica is not serving", func() bool { return !h.serving(next) })
+
+	if _, err := h.admin(next).Drain(context.Background(), &proto.DrainRequest{Resume: true}); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	h.eventually("the resumed replica is serving", func() bool { return h.serving(next) })
+}
+
+func TestBidsSurviveFaultyNetwork(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	// replication calls may arrive twice or out of order; the forwarded
+	// client calls are only lost or late, as a repeated bid is a new bid
+	h.inject(
+		&proto.FaultRule{Methods: []string{"RequestVote", "AppendEntries"}, Drop: 0.2, Duplicate: 0.3, Reorder: 0.3, ReorderMillis: 60, JitterMillis: 10},
+		&proto.FaultRule{Drop: 0.2, DelayMillis: 5, JitterMillis: 20},
+	)
+	anna := h.register(0, "Anna").Token
+	karoline := h.register(1, "Karoline").Token
+
+	for i := 1; i <= 10; i++ {
+		bidder, token := "Anna", anna
+		if i%2 == 0 {
+			bidder, token = "Karoline", karoline
+		}
+		h.bid(i%3, &proto.Amount{Amount: int64(10 * i), Bidder: bidder, Token: token})
+	}
+	h.converged("", "Karoline", 100)
+
+	h.inject()
+	if ack := h.bid(2, &proto.Amount{Amount: 110, Bidder: "Anna", Token: anna}); ack != "success" {
+		t.Fatalf("bid after the network recovered: got %q", ack)
+	}
+	h.converged("", "Anna", 110)
+}
+
+func TestAuctionClose(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	token := h.register(0, "Anna").Token
+	ctx := context.Background()
+
+	h.eventually("spring is created", func() bool {
+		_, err := h.client(1).CreateAuction(ctx, &proto.AuctionSpec{Auction: "spring"})
+		return err == nil
+	})
+	h.eventually("summer is created", func() bool {
+		_, err := h.client(2).CreateAuction(ctx, &proto.AuctionSpec{Auction: "summer", DurationSeconds: 1})
+		return err == nil
+	})
+
+	if ack := h.bid(0, &proto.Amount{Amount: 5, Bidder: "Anna", Token: token, Auction: "spring"}); ack != "success" {
+		t.Fatalf("bid in spring: got %q", ack)
+	}
+	if _, err := h.client(1).CloseAuction(ctx, &proto.AuctionRef{Auction: "spring"}); err != nil {
+		t.Fatalf("close spring: %v", err)
+	}
+	if ack := h.bid(2, &proto.Amount{Amount: 6, Bidder: "Anna", Token: token, Auction: "spring"}); ack != "fail" {
+		t.Fatalf("bid in closed auction: got %q, want fail", ack)
+	}
+
+	// summer closes by itself once its deadline passes, on every replica
+	for i := 0; i < 3; i++ {
+		h.eventually("summer is over", func() bool {
+			s := h.server(i)
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			a, ok := s.auctions["summer"]
+			return ok && a.isAuctionOver
+		})
+	}
+	outcome, err := h.client(0).Result(ctx, &proto.AuctionRef{Auction: "summer"})
+	if err != nil || !outcome.Over || outcome.Result != "Auction over, there were no bids" {
+		t.Fatalf("result of summer: got %v, %v", outcome, err)
+	}
+	if _, err := h.client(0).Result(ctx, &proto.AuctionRef{Auction: "winter"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("result of unknown auction: got %v, want NotFound", err)
+	}
+}
+
+func TestBidCurrencyIsChecked(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	token := h.register(0, "Anna").Token
+	ctx := context.Background()
+
+	if _, err := h.client(0).CreateAuction(ctx, &proto.AuctionSpec{Auction: "coins", Currency: "XYZ"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("auction in XYZ: got %v, want InvalidArgument", err)
+	}
+	h.eventually("tokyo is created", func() bool {
+		_, err := h.client(1).CreateAuction(ctx, &proto.AuctionSpec{Auction: "tokyo", Currency: "jpy"})
+		return err == nil
+	})
+
+	if _, err := h.client(2).Bid(ctx, &proto.Amount{Amount: 1500, Bidder: "Anna", Token: token, Auction: "tokyo", Currency: "EUR"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("bid in EUR: got %v, want InvalidArgument", err)
+	}
+	if ack := h.bid(0, &proto.Amount{Amount: 1500, Bidder: "Anna", Token: token, Auction: "tokyo", Currency: "jpy"}); ack != "success" {
+		t.Fatalf("bid in jpy: got %q", ack)
+	}
+	outcome, err := h.client(1).Result(ctx, &proto.AuctionRef{Auction: "tokyo"})
+	if err != nil || outcome.Over || outcome.Currency != "JPY" || outcome.Result != "Auction is ongoing, the highest bidder is Anna with 1500 JPY" {
+		t.Fatalf("result of tokyo: got %v, %v", outcome, err)
+	}
+
+	var reasons []string
+	h.eventually("both bids are in the trail", func() bool {
+		stream, err := h.client(0).ExportAudit(ctx, &proto.AuctionRef{Auction: "tokyo"})
+		if err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		reasons = nil
+		for {
+			rec, err := stream.Recv()
+			if err != nil {
+				break
+			}
+			reasons = append(reasons, rec.Currency+" "+rec.Reason)
+		}
+		return len(reasons) == 2
+	})
+	if want := []string{"EUR wrong_currency", "JPY accepted"}; !slices.Equal(reasons, want) {
+		t.Errorf("trail: got %q, want %q", reasons, want)
+	}
+}
+
+func TestWatchStreamsBidsAndClose(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	anna := h.register(0, "Anna").Token
+	bo := h.register(0, "Bo").Token
+	if ack := h.bid(0, &proto.Amount{Amount: 5, Bidder: "Anna", Token: anna}); ack != "success" {
+		t.Fatalf("first bid: got %q", ack)
+	}
+	h.converged("default", "Anna", 5)
+
+	// watch through a follower, which sends the events as it applies them
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var stream proto.AuctionServer_WatchClient
+	var state *proto.Event
+	h.eventually("the watch starts", func() bool {
+		var err error
+		if stream, err = h.client(2).Watch(ctx, &proto.AuctionRef{}); err == nil {
+			state, err = stream.Recv()
+		}
+		return err == nil
+	})
+	if state.Kind != "state" || state.HighestBidder != "Anna" || state.HighestBid != 5 {
+		t.Fatalf("first event: got %v, want the state with Anna's bid", state)
+	}
+
+	h.bid(1, &proto.Amount{Amount: 7, Bidder: "Bo", Token: bo})
+	h.bid(0, &proto.Amount{Amount: 6, Bidder: "Anna", Token: anna})
+	if _, err := h.client(0).CloseAuction(context.Background(), &proto.AuctionRef{}); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	var got []string
+	last := state.Index
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		if ev.Index <= last {
+			t.Errorf("event %v does not come after index %d", ev, last)
+		}
+		last = ev.Index
+		got = append(got, fmt.Sprintf("%s %s %d %v %s", ev.Kind, ev.Bidder, ev.Amount, ev.Accepted, ev.Outbid))
+	}
+	want := []string{"bid Bo 7 true Anna", "bid Anna 6 false ", "close  0 false "}
+	if !slices.Equal(got, want) {
+		t.Errorf("events: got %q, want %q", got, want)
+	}
+
+	winter, err := h.client(2).Watch(ctx, &proto.AuctionRef{Auction: "winter"})
+	if err == nil {
+		_, err = winter.Recv()
+	}
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("watch of an unknown auction: got %v, want NotFound", err)
+	}
+}
+
+func TestWebhooksAreDeliveredOnce(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	anna := h.register(0, "Anna").Token
+	bo := h.register(0, "Bo").Token
+
+	// the receiver fails its first call, so that one is retried
+	var mu sync.Mutex
+	var calls int
+	got := make(map[string]int) // "id event bidder amount" -> deliveries
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if r.Header.Get("X-Webhook-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("webhook %s has a wrong signature", body)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if calls++; calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p webhookPayload
+		json.Unmarshal(body, &p)
+		got[fmt.Sprintf("%s %s %s %d", r.Header.Get("X-Webhook-Event"), p.Event, p.Bidder, p.Amount)]++
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	if _, err := h.client(1).AddWebhook(ctx, &proto.Webhook{Url: "ftp://example.com", Secret: "secret"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("webhook with an ftp URL: got %v, want InvalidArgument", err)
+	}
+	if _, err := h.client(1).AddWebhook(ctx, &proto.Webhook{Url: receiver.URL, Secret: "secret"}); err != nil {
+		t.Fatalf("add webhook: %v", err)
+	}
+
+	h.bid(0, &proto.Amount{Amount: 5, Bidder: "Anna", Token: anna})
+	h.bid(1, &proto.Amount{Amount: 7, Bidder: "Bo", Token: bo})
+	h.bid(2, &proto.Amount{Amount: 9, Bidder: "Anna", Token: anna})
+	if _, err := h.client(0).CloseAuction(ctx, &proto.AuctionRef{}); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		h.eventually("no deliveries are pending", func() bool {
+			s := h.server(i)
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			return len(s.deliveries) == 0
+		})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]int{
+		"outbid outbid Anna 7": 1,
+		"outbid outbid Bo 9":   1,
+		"closed closed Anna 9": 1,
+		"winner winner Anna 9": 1,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("deliveries: got %v, want %v", got, want)
+	}
+}
+
+func TestAuditTrail(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	anna := h.register(0, "Anna").Token
+	bo := h.register(0, "Bo").Token
+	ctx := context.Background()
+
+	h.bid(0, &proto.Amount{Amount: 5, Bidder: "Anna", Token: anna})
+	h.bid(1, &proto.Amount{Amount: 3, Bidder: "Bo", Token: bo})
+	if _, err := h.client(2).Bid(ctx, &proto.Amount{Amount: 8, Bidder: "Bo", Token: anna}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("bid with Anna's token: got %v, want Unauthenticated", err)
+	}
+	if _, err := h.client(0).CloseAuction(ctx, &proto.AuctionRef{}); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	h.bid(2, &proto.Amount{Amount: 9, Bidder: "Bo", Token: bo})
+
+	want := []string{
+		h.addrs[0] + " Anna 5 accepted",
+		h.addrs[1] + " Bo 3 too_low",
+		h.addrs[2] + " Bo 8 unauthenticated",
+		h.addrs[2] + " Bo 9 closed",
+	}
+	for i := range h.addrs {
+		var got []string
+		var records []ledger.Record
+		h.eventually("the trail is complete", func() bool {
+			stream, err := h.client(i).ExportAudit(ctx, &proto.AuctionRef{})
+			if err != nil {
+				t.Fatalf("export: %v", err)
+			}
+			got, records = nil, nil
+			for {
+				rec, err := stream.Recv()
+				if err != nil {
+					break
+				}
+				records = append(records, ledger.FromProto(rec))
+				got = append(got, fmt.Sprintf("%s %s %d %s", rec.Replica, rec.Bidder, rec.Amount, rec.Reason))
+			}
+			return len(got) == len(want)
+		})
+		if !slices.Equal(got, want) {
+			t.Errorf("trail on %s: got %q, want %q", h.addrs[i], got, want)
+		}
+		if err := ledger.Verify(records); err != nil {
+			t.Errorf("trail on %s: %v", h.addrs[i], err)
+		}
+	}
+}
+
+func TestMadeUpBiddersStayOutOfTheLog(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	anna := h.register(0, "Anna").Token
+	ctx := context.Background()
+	long := strings.Repeat("x", maxName+1)
+
+	if _, err := h.client(0).Register(ctx, &proto.Registration{Bidder: long}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("registering a long name: got %v, want InvalidArgument", err)
+	}
+	for _, req := range []*proto.Amount{
+		{Amount: 5, Bidder: long, Token: anna},
+		{Amount: 5, Bidder: "Anna", Token: anna, Auction: long},
+		{Amount: 5, Bidder: "Anna", Token: anna, Currency: long},
+	} {
+		if _, err := h.client(1).Bid(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("bid with a long field: got %v, want InvalidArgument", err)
+		}
+	}
+	h.eventually("Mallory is turned away", func() bool {
+		_, err := h.client(2).Bid(ctx, &proto.Amount{Amount: 6, Bidder: "Mallory", Token: "guess"})
+		return status.Code(err) == codes.Unauthenticated
+	})
+	h.bid(0, &proto.Amount{Amount: 7, Bidder: "Anna", Token: anna})
+
+	// Anna's bid comes after the others in the log, so once it is in the
+	// trail they would be too
+	var got []string
+	h.eventually("Anna's bid is in the trail", func() bool {
+		stream, err := h.client(0).ExportAudit(ctx, &proto.AuctionRef{})
+		if err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		got = nil
+		for {
+			rec, err := stream.Recv()
+			if err != nil {
+				break
+			}
+			got = append(got, fmt.Sprintf("%s %d %s", rec.Bidder, rec.Amount, rec.Reason))
+		}
+		return slices.Contains(got, "Anna 7 accepted")
+	})
+	if want := []string{"Anna 7 accepted"}; !slices.Equal(got, want) {
+		t.Errorf("trail: got %q, want %q", got, want)
+	}
+}
+
+func TestVerifyLedgerFindsTampering(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	leader := h.waitLeader()
+	anna := h.register(leader, "Anna").Token
+	h.bid(leader, &proto.Amount{Amount: 5, Bidder: "Anna", Token: anna})
+	h.bid(leader, &proto.Amount{Amount: 7, Bidder: "Anna", Token: anna})
+	h.converged("", "Anna", 7)
+	ctx := context.Background()
+
+	verify := func(i int) *proto.LedgerReport {
+		report, err := h.admin(i).VerifyLedger(ctx, &proto.Empty{})
+		if err != nil {
+			t.Fatalf("verify %d: %v", i, err)
+		}
+		return report
+	}
+	h.eventually("the replicas have the same head", func() bool {
+		want := verify(leader)
+		for i := range h.addrs {
+			if got := verify(i); got.MismatchIndex != 0 || got.LastIndex != want.LastIndex || got.HeadHash != want.HeadHash {
+				return false
+			}
+		}
+		return true
+	})
+
+	// an older entry changed in place breaks the replica's own chain
+	changed, headless := (leader+1)%3, (leader+2)%3
+	s := h.server(changed)
+	s.mutex.Lock()
+	var index int64
+	for i := s.base() + 1; i <= s.lastIndex(); i++ {
+		if bid := s.entry(i).GetBid(); bid != nil {
+			bid.Amount, index = 50, i
+			break
+		}
+	}
+	s.mutex.Unlock()
+	if got := verify(changed); got.MismatchIndex != index+1 || got.Peer != "" {
+		t.Fatalf("verify the changed replica: got %v, want a mismatch at %d", got, index+1)
+	}
+
+	// a changed last entry still chains, but differs from the leader's
+	s = h.server(headless)
+	s.mutex.Lock()
+	s.entry(s.lastIndex()).Time++
+	last := s.lastIndex()
+	s.mutex.Unlock()
+	if ack := h.bid(leader, &proto.Amount{Amount: 9, Bidder: "Anna", Token: anna}); ack != "success" {
+		t.Fatalf("bid with one replica refusing entries: got %q", ack)
+	}
+	h.eventually("both replicas see the mismatch", func() bool {
+		a, b := verify(headless), verify(leader)
+		return a.MismatchIndex == last && a.Peer == h.server(leader).id &&
+			b.MismatchIndex == last && b.Peer == h.server(headless).id
+	})
+}
+
+func TestDurableStoresSurviveFullRestart(t *testing.T) {
+	for _, kind := range []string{"file", "bolt"} {
+		t.Run(kind, func(t *testing.T) {
+			h := newHarness(t, 3, nil)
+			h.useStores(kind)
+			leader := h.waitLeader()
+			anna := h.register(leader, "Anna").Token
+			h.bid(leader, &proto.Amount{Amount: 5, Bidder: "Anna", Token: anna})
+			h.converged("", "Anna", 5)
+			if _, err := h.admin(leader).Snapshot(context.Background(), &proto.Empty{}); err != nil {
+				t.Fatalf("snapshot: %v", err)
+			}
+			h.bid(leader, &proto.Amount{Amount: 7, Bidder: "Anna", Token: anna})
+			h.converged("", "Anna", 7)
+
+			// without the stores this would lose every bid
+			for i := range h.addrs {
+				h.crash(i)
+			}
+			for i := range h.addrs {
+				h.start(i)
+			}
+			h.converged("", "Anna", 7)
+			leader = h.waitLeader()
+			if ack := h.bid(leader, &proto.Amount{Amount: 9, Bidder: "Anna", Token: anna}); ack != "success" {
+				t.Fatalf("bid after the restart: got %q", ack)
+			}
+		})
+	}
+}
+
+func TestBidsNeedRegisteredToken(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	token := h.register(0, "Anna").Token
+
+	ctx := context.Background()
+	if _, err := h.client(1).Register(ctx, &proto.Registration{Bidder: "Anna"}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("registering Anna twice: got %v, want AlreadyExists", err)
+	}
+
+	// every replica learns about Anna, not just the leader
+	for i := 0; i < 3; i++ {
+		h.eventually("Anna is known everywhere", func() bool {
+			s := h.server(i)
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			_, ok := s.bidders["Anna"]
+			return ok
+		})
+	}
+
+	if _, err := h.client(2).Bid(ctx, &proto.Amount{Amount: 10, Bidder: "Anna", Token: "guess"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("bid with wrong token: got %v, want Unauthenticated", err)
+	}
+	if _, err := h.client(2).Bid(ctx, &proto.Amount{Amount: 10, Bidder: "Mallory", Token: token}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("bid from unregistered bidder: got %v, want Unauthenticated", err)
+	}
+	if ack := h.bid(2, &proto.Amount{Amount: 10, Bidder: "Anna", Token: token}); ack != "success" {
+		t.Fatalf("bid with Anna's token: got %q, want success", ack)
+	}
+}
+
+func TestRolesAreEnforced(t *testing.T) {
+	signer := security.NewSigner([]byte("a key only used by this test...."))
+	h := newHarness(t, 3, signer)
+	ctx := context.Background()
+
+	as := func(token string) grpc.CallOption {
+		return grpc.PerRPCCredentials(security.NewBearerToken(token))
+	}
+	auctioneer, err := signer.Issue("alice", security.RoleAuctioneer, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// registering is open to anyone and hands out a bidder token
+	anna := h.register(0, "Anna")
+	if anna.AccessToken == "" {
+		t.Fatal("registration did not return an access token")
+	}
+
+	bid := &proto.Amount{Amount: 10, Bidder: "Anna", Token: anna.Token, Auction: "spring"}
+	if _, err := h.client(1).Bid(ctx, bid); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("bid without bearer token: got %v, want Unauthenticated", err)
+	}
+	if _, err := h.client(1).CreateAuction(ctx, &proto.AuctionSpec{Auction: "spring"}, as(anna.AccessToken)); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("bidder creating an auction: got %v, want PermissionDenied", err)
+	}
+	if _, err := h.client(1).CreateAuction(ctx, &proto.AuctionSpec{Auction: "spring"}, as(auctioneer)); err != nil {
+		t.Fatalf("auctioneer creating an auction: %v", err)
+	}
+
+	karoline := &proto.Amount{Amount: 20, Bidder: "Karoline", Token: anna.Token, Auction: "spring"}
+	if _, err := h.client(2).Bid(ctx, karoline, as(anna.AccessToken)); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("bidding as someone else: got %v, want PermissionDenied", err)
+	}
+	if ack := h.bid(2, bid, as(anna.AccessToken)); ack != "success" {
+		t.Fatalf("bid in spring: got %q, want success", ack)
+	}
+
+	if _, err := h.client(0).CloseAuction(ctx, &proto.AuctionRef{Auction: "spring"}, as(auctioneer)); err != nil {
+		t.Fatalf("auctioneer closing an auction: %v", err)
+	}
+	bid.Amount = 30
+	if ack := h.bid(2, bid, as(anna.AccessToken)); ack != "fail" {
+		t.Fatalf("bid after close: got %q, want fail", ack)
+	}
+
+	// the default auction is untouched by what happened in spring
+	outcome, err := h.client(0).Result(ctx, &proto.AuctionRef{}, as(anna.AccessToken))
+	if err != nil || outcome.HighestBidder != "" {
+		t.Fatalf("default auction: got %v, %v; want no bids", outcome, err)
+	}
+
+	// only replicas may use the replication service
+	conn, err := grpc.Dial(h.addrs[0], h.dialOptions(clientAddr)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := proto.NewReplicaClient(conn).AppendEntries(ctx, &proto.AppendRequest{Term: 1000}, as(auctioneer)); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("auctioneer calling AppendEntries: got %v, want PermissionDenied", err)
+	}
+}
+
+func TestLoginHandsOutFreshAccessToken(t *testing.T) {
+	signer := security.NewSigner([]byte("a key only used by this test...."))
+	h := newHarness(t, 3, signer)
+	ctx := context.Background()
+	anna := h.register(0, "Anna")
+
+	// a returning bidder only has the token from registering
+	if _, err := h.client(1).Register(ctx, &proto.Registration{Bidder: "Anna"}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("registering again: got %v, want AlreadyExists", err)
+	}
+	if _, err := h.client(1).Login(ctx, &proto.Credentials{Bidder: "Anna", Token: "guess"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("login with a wrong token: got %v, want Unauthenticated", err)
+	}
+	creds, err := h.client(1).Login(ctx, &proto.Credentials{Bidder: "Anna", Token: anna.Token})
+	if err != nil || creds.AccessToken == "" {
+		t.Fatalf("login: got %v, %v", creds, err)
+	}
+	claims, err := signer.Verify(creds.AccessToken)
+	if err != nil || claims.Subject != "Anna" || claims.Role != security.RoleBidder {
+		t.Fatalf("access token: got %+v, %v", claims, err)
+	}
+	bid := &proto.Amount{Amount: 10, Bidder: "Anna", Token: anna.Token}
+	if ack := h.bid(2, bid, grpc.PerRPCCredentials(security.NewBearerToken(creds.AccessToken))); ack != "success" {
+		t.Fatalf("bid after login: got %q", ack)
+	}
+}
+
+func TestBidLimitHoldsAcrossReplicas(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	for i := 0; i < 3; i++ {
+		h.server(i).bidLimit = newLimiter(0.5, 2)
+	}
+	token := h.register(0, "Anna").Token
+	// make sure a leader is in place before the burst
+	h.bid(0, &proto.Amount{Amount: 1, Bidder: "Anna", Token: token})
+
+	// spreading bids over all replicas still only gets the bucket's worth
+	answered, limited := 0, 0
+	for i := 0; i < 6; i++ {
+		req := &proto.Amount{Amount: int64(10 + i), Bidder: "Anna", Token: token}
+		_, err := h.client(i%3).Bid(context.Background(), req)
+		switch status.Code(err) {
+		case codes.OK:
+			answered++
+		case codes.ResourceExhausted:
+			limited++
+		default:
+			t.Fatalf("bid %d: %v", i, err)
+		}
+	}
+	if answered > 2 || limited < 4 {
+		t.Fatalf("got %d answered and %d limited bids, want at most 2 answered", answered, limited)
+	}
+}
+
+func TestClientsCannotPoseAsReplicas(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	token := h.register(0, "Anna").Token
+	h.bid(0, &proto.Amount{Amount: 1, Bidder: "Anna", Token: token})
+	for i := 0; i < 3; i++ {
+		h.server(i).bidLimit = nil
+		h.server(i).addrLimit = newLimiter(0.5, 2)
+	}
+
+	// a new address on every bid would get a new bucket every time, if the
+	// replicas believed it
+	limited := 0
+	for i := 0; i < 6; i++ {
+		ctx := metadata.AppendToOutgoingContext(context.Background(),
+			forwardedFor, fmt.Sprintf("10.0.0.%d", i), forwardedBy, "node-9")
+		req := &proto.Amount{Amount: int64(10 + i), Bidder: "Anna", Token: token}
+		_, err := h.client(i%3).Bid(ctx, req)
+		switch status.Code(err) {
+		case codes.OK:
+		case codes.ResourceExhausted:
+			limited++
+		default:
+			t.Fatalf("bid %d: %v", i, err)
+		}
+	}
+	if limited < 4 {
+		t.Fatalf("got %d limited bids, want at least 4", limited)
+	}
+
+	stream, err := h.client(0).ExportAudit(context.Background(), &proto.AuctionRef{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		rec, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		if rec.Replica == "node-9" {
+			t.Errorf("bid %d was recorded as received by node-9", rec.Amount)
+		}
+	}
+}
+
+func TestHistoryIsLinearizable(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	recorder := history.NewRecorder()
+
+	bidders := []string{"Anna", "Karoline", "Stina"}
+	var wg sync.WaitGroup
+	for b, name := range bidders {
+		f, err := frontend.Dial(h.addrs, "", h.dialOptions(clientAddr)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		f.Record(recorder)
+		token := h.register(b, name).Token
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 15; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				if i%3 == 2 {
+					f.Result(ctx, "")
+				} else {
+					f.Bid(ctx, &proto.Amount{Amount: int64(10*i + b), Bidder: name, Token: token})
+				}
+				cancel()
+			}
+		}()
+	}
+
+	// lose the leader while the bidders are busy
+	time.Sleep(100 * time.Millisecond)
+	h.crash(h.waitLeader())
+	wg.Wait()
+
+	ops, err := history.Operations(recorder.Events())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !history.Check(history.AuctionModel, ops).Linearizable {
+		t.Fatalf("history of %d operations is not linearizable", len(ops))
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	h := newHarness(t, 3, nil)
+	leader := h.waitLeader()
+	token := h.register(leader, "Anna").Token
+	h.bid(leader, &proto.Amount{Amount: 50, Bidder: "Anna", Token: token})
+	h.bid((leader+1)%3, &proto.Amount{Amount: 40, Bidder: "Anna", Token: token})
+	if _, err := h.client(leader).Bid(context.Background(), &proto.Amount{Amount: 60, Bidder: "Anna", Token: token, Auction: "spring"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("bid in an unknown auction: got %v", err)
+	}
+	h.converged("", "Anna", 50)
+
+	rec := httptest.NewRecorder()
+	h.server(leader).metrics.handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`auction_bids_total{outcome="accepted"} 1`,
+		`auction_bids_total{outcome="too_low"} 1`,
+		`auction_bids_total{outcome="not_found"} 1`,
+		`auction_highest_bid{auction="default",closed="false",currency="DKK"} 0.5`,
+		`auction_leader 1`,
+		`auction_replication_lag{peer=`,
+		`auction_replication_seconds_count{method="AppendEntries",peer=`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if t.Failed() {
+		t.Log(body)
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	proto "Replication/grpc"
+
+	gproto "google.golang.org/protobuf/proto"
+)
+
+var (
+	simSeed  = flag.Int64("sim.seed", 0, "Run the simulation with this seed only")
+	simSeeds = flag.Int("sim.seeds", 20, "Number of seeds the simulation tries")
+	simSteps = flag.Int("sim.steps", 3000, "Steps in every simulated run")
+)
+
+// simulator runs a whole cluster in one goroutine. Every message between
+// the replicas waits in a queue until the simulator delivers, drops or
+// duplicates it, and the replicas only tick, crash and restart when the
+// simulator says so. All choices come from one seed, so a run that breaks an
+// invariant can be replayed.
+type simulator struct {
+	seed  int64
+	rand  *rand.Rand
+	clock *simClock
+	addrs []string
+	nodes map[string]*AuctionServer // nil while a replica is down
+	queue []*simMessage
+	cut   map[[2]string]bool
+
+	// with durable stores the replicas keep their stores across crashes,
+	// without they forget everything
+	durable bool
+	stores  map[string]*memoryStore
+
+	leaders   map[int64]string // the leader seen in each term
+	committed []*proto.Entry   // the committed log, from index 1
+	checked   map[string]int64 // how much of each replica's log has been compared with committed
+	pending   []simBid
+	acked     []*proto.Amount
+	trace     []string
+}
+
+type simMessage struct {
+	from, to string
+	what     string
+	deliver  func()
+}
+
+// simBid is a bid the simulator has given to a leader and waits on.
+type simBid struct {
+	bid *proto.Amount
+	ch  chan string
+}
+
+// violation is how the simulator stops a run that broke an invariant.
+type violation string
+
+func newSimulator(seed int64, n int) *simulator {
+	sim := &simulator{
+		seed:    seed,
+		rand:    rand.New(rand.NewSource(seed)),
+		clock:   &simClock{now: time.Unix(1700000000, 0)},
+		nodes:   make(map[string]*AuctionServer),
+		durable: seed%2 == 0,
+		stores:  make(map[string]*memoryStore),
+		cut:     make(map[[2]string]bool),
+		leaders: make(map[int64]string),
+		checked: make(map[string]int64),
+	}
+	for i := 0; i < n; i++ {
+		sim.addrs = append(sim.addrs, fmt.Sprintf("node-%d", i))
+	}
+	for _, addr := range sim.addrs {
+		sim.start(addr)
+	}
+	return sim
+}
+
+// start boots a replica with what its store saved, if it is durable, or
+// else with empty state.
+func (sim *simulator) start(addr string) {
+	t := &simTransport{sim: sim, from: addr}
+	s := newReplica(addr, sim.addrs, sim.clock, t, rand.New(rand.NewSource(sim.rand.Int63())))
+	if !sim.durable || sim.stores[addr] == nil {
+		sim.stores[addr] = &memoryStore{}
+	}
+	if err := s.UseStore(sim.stores[addr]); err != nil {
+		sim.fail("%s cannot load its store: %v", addr, err)
+	}
+	t.self = s
+	sim.nodes[addr] = s
+	sim.checked[addr] = 0
+}
+
+func (sim *simulator) logf(format string, args ...any) {
+	sim.trace = append(sim.trace, fmt.Sprintf("%s ", sim.clock.now.Format("15:04:05.000"))+fmt.Sprintf(format, args...))
+}
+
+func (sim *simulator) fail(format string, args ...any) {
+	panic(violation(fmt.Sprintf(format, args...)))
+}
+
+func (sim *simulator) send(from, to, what string, deliver func()) {
+	sim.queue = append(sim.queue, &simMessage{from: from, to: to, what: what, deliver: deliver})
+}
+
+// take removes a message from the queue, mostly the oldest.
+func (sim *simulator) take() *simMessage {
+	i := 0
+	if sim.rand.Intn(5) == 0 {
+		i = sim.rand.Intn(len(sim.queue))
+	}
+	m := sim.queue[i]
+	sim.queue = append(sim.queue[:i], sim.queue[i+1:]...)
+	return m
+}
+
+func (sim *simulator) up() []string {
+	var up []string
+	for _, addr := range sim.addrs {
+		if sim.nodes[addr] != nil {
+			up = append(up, addr)
+		}
+	}
+	return up
+}
+
+// healthy reports whether every replica is up and has caught up since its
+// last restart. Replicas without durable stores forget everything when they
+// crash, so only then may another one crash without the cluster losing
+// committed bids.
+func (sim *simulator) healthy() bool {
+	if sim.durable {
+		return true
+	}
+	for _, addr := range sim.addrs {
+		s := sim.nodes[addr]
+		if s == nil {
+			return false
+		}
+		s.mutex.Lock()
+		recovering := s.recovering
+		s.mutex.Unlock()
+		if recovering {
+			return false
+		}
+	}
+	return true
+}
+
+// step makes one random thing happen. With faults off only messages are
+// delivered and replicas tick.
+func (sim *simulator) step(faults bool) {
+	up := sim.up()
+	roll := sim.rand.Intn(100)
+	if !faults {
+		roll %= 75
+	}
+	switch {
+	case roll < 45:
+		if len(sim.queue) == 0 {
+			return
+		}
+		m := sim.take()
+		if sim.cut[[2]string{m.from, m.to}] {
+			sim.logf("lost %s %s->%s", m.what, m.from, m.to)
+			return
+		}
+		sim.logf("deliver %s %s->%s", m.what, m.from, m.to)
+		m.deliver()
+	case roll < 75:
+		if len(up) == 0 {
+			return
+		}
+		sim.clock.advance(tickInterval / time.Duration(len(sim.addrs)))
+		sim.nodes[up[sim.rand.Intn(len(up))]].tick()
+	case roll < 84:
+		sim.bid(up)
+	case roll < 85:
+		if len(up) > 0 {
+			addr := up[sim.rand.Intn(len(up))]
+			s := sim.nodes[addr]
+			s.mutex.Lock()
+			if n := s.takeSnapshot(); n > 0 {
+				sim.logf("%s compacts %d entries", addr, n)
+			}
+			s.mutex.Unlock()
+		}
+	case roll < 89:
+		if len(sim.queue) > 0 {
+			m := sim.take()
+			sim.logf("drop %s %s->%s", m.what, m.from, m.to)
+		}
+	case roll < 92:
+		if len(sim.queue) > 0 {
+			m := sim.queue[sim.rand.Intn(len(sim.queue))]
+			sim.logf("duplicate %s %s->%s", m.what, m.from, m.to)
+			sim.queue = append(sim.queue, m)
+		}
+	case roll < 93:
+		if sim.healthy() {
+			addr := sim.addrs[sim.rand.Intn(len(sim.addrs))]
+			if sim.nodes[addr] != nil {
+				sim.logf("crash %s", addr)
+				sim.nodes[addr] = nil
+			}
+		}
+	case roll < 96:
+		for _, addr := range sim.addrs {
+			if sim.nodes[addr] == nil {
+				sim.logf("restart %s", addr)
+				sim.start(addr)
+				break
+			}
+		}
+	case roll < 97:
+		addr := sim.addrs[sim.rand.Intn(len(sim.addrs))]
+		sim.logf("isolate %s", addr)
+		for _, other := range sim.addrs {
+			sim.cut[[2]string{addr, other}] = true
+			sim.cut[[2]string{other, addr}] = true
+		}
+	default:
+		if len(sim.cut) > 0 {
+			sim.logf("heal")
+			sim.cut = make(map[[2]string]bool)
+		}
+	}
+}
+
+// bid gives a random bid to a replica that believes it leads.
+func (sim *simulator) bid(up []string) {
+	if len(up) == 0 {
+		return
+	}
+	addr := up[sim.rand.Intn(len(up))]
+	bid := &proto.Amount{
+		Bidder:  []string{"Anna", "Karoline", "Sofie"}[sim.rand.Intn(3)],
+		Amount:  int64(1 + sim.rand.Intn(1000)),
+		Auction: defaultAuction,
+	}
+	_, ch, err := sim.nodes[addr].submit(context.Background(), &proto.Entry{Op: &proto.Entry_Bid{Bid: bid}})
+	if err != nil {
+		return
+	}
+	sim.logf("%s takes %s's bid of %d", addr, bid.Bidder, bid.Amount)
+	sim.pending = append(sim.pending, simBid{bid: bid, ch: ch})
+}
+
+// check looks at every replica after a step.
+func (sim *simulator) check() {
+	for _, addr := range sim.addrs {
+		s := sim.nodes[addr]
+		if s == nil {
+			continue
+		}
+		s.mutex.Lock()
+		if s.role == leader {
+			if other, ok := sim.leaders[s.term]; ok && other != addr {
+				s.mutex.Unlock()
+				sim.fail("%s and %s both lead term %d", other, addr, s.term)
+			}
+			sim.leaders[s.term] = addr
+		}
+		// entries a snapshot replaced cannot be compared any more
+		from := max(sim.checked[addr], s.base()) + 1
+		for i := from; i <= s.commitIndex; i++ {
+			if int(i) > len(sim.committed) {
+				sim.committed = append(sim.committed, s.entry(i))
+			} else if !gproto.Equal(sim.committed[i-1], s.entry(i)) {
+				s.mutex.Unlock()
+				sim.fail("%s committed %v at index %d, but %v was committed there before", addr, s.entry(i), i, sim.committed[i-1])
+			}
+		}
+		sim.checked[addr] = s.commitIndex
+		if s.mismatch != nil {
+			s.mutex.Unlock()
+			sim.fail("%s found a hash chain mismatch at index %d: %s", addr, s.mismatch.MismatchIndex, s.mismatch.Reason)
+		}
+		s.mutex.Unlock()
+	}
+
+	still := sim.pending[:0]
+	for _, p := range sim.pending {
+		select {
+		case ack, ok := <-p.ch:
+			if ok && ack == "success" {
+				sim.acked = append(sim.acked, p.bid)
+			}
+		default:
+			still = append(still, p)
+		}
+	}
+	sim.pending = still
+}
+
+// settle heals the network, restarts every replica and lets the cluster
+// run without faults until all replicas have applied the same log.
+func (sim *simulator) settle() {
+	sim.logf("settle")
+	sim.cut = make(map[[2]string]bool)
+	for _, addr := range sim.addrs {
+		if sim.nodes[addr] == nil {
+			sim.start(addr)
+		}
+	}
+	for i := 0; i < 20000 && !sim.converged(); i++ {
+		sim.step(false)
+		sim.check()
+	}
+	if !sim.converged() {
+		sim.fail("the replicas did not converge once the faults stopped")
+	}
+}
+
+// converged reports whether there is a leader and every replica has applied
+// all of its log.
+func (sim *simulator) converged() bool {
+	var applied int64 = -1
+	leaders := 0
+	for _, addr := range sim.addrs {
+		s := sim.nodes[addr]
+		s.mutex.Lock()
+		if s.role == leader {
+			leaders++
+		}
+		if applied == -1 {
+			applied = s.lastIndex()
+		}
+		ok := s.lastApplied == applied && s.lastIndex() == applied
+		s.mutex.Unlock()
+		if !ok {
+			return false
+		}
+	}
+	return leaders == 1
+}
+
+// final checks that the replicas agree on every auction and that no
+// acknowledged bid got lost.
+func (sim *simulator) final() {
+	first := sim.nodes[sim.addrs[0]]
+	for _, addr := range sim.addrs {
+		if index, reason := sim.nodes[addr].verifyChain(); index != 0 {
+			sim.fail("%s has a broken hash chain: %s", addr, reason)
+		}
+		if head, want := sim.nodes[addr].hashAt(sim.nodes[addr].lastIndex()), first.hashAt(first.lastIndex()); head != want {
+			sim.fail("%s and %s have different chain heads", sim.addrs[0], addr)
+		}
+	}
+	for _, addr := range sim.addrs[1:] {
+		s := sim.nodes[addr]
+		for id, want := range first.auctions {
+			got, ok := s.auctions[id]
+			if !ok || got.highestBidder != want.highestBidder || got.highestBid != want.highestBid {
+				sim.fail("%s and %s disagree on auction %s", sim.addrs[0], addr, id)
+			}
+		}
+	}
+	for _, bid := range sim.acked {
+		found := false
+		for _, e := range sim.committed {
+			if gproto.Equal(e.GetBid(), bid) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			sim.fail("%s's acknowledged bid of %d is not in the committed log", bid.Bidder, bid.Amount)
+		}
+	}
+}
+
+// run plays steps random steps, settles and checks the outcome. It returns
+// the trace and the broken invariant, if any.
+func (sim *simulator) run(steps int) (trace []string, broken string) {
+	defer func() {
+		if v, ok := recover().(violation); ok {
+			trace, broken = sim.trace, string(v)
+		}
+	}()
+	for i := 0; i < steps; i++ {
+		sim.step(true)
+		sim.check()
+	}
+	sim.settle()
+	sim.final()
+	return sim.trace, ""
+}
+
+// simTransport hands the replication calls of one replica to the simulator.
+// Replies to a replica that has crashed since are thrown away.
+type simTransport struct {
+	sim  *simulator
+	from string
+	self *AuctionServer
+}
+
+func (t *simTransport) RequestVote(peer string, req *proto.VoteRequest, done func(*proto.VoteReply)) {
+	req = gproto.Clone(req).(*proto.VoteRequest)
+	t.sim.send(t.from, peer, "RequestVote", func() {
+		target := t.sim.nodes[peer]
+		if target == nil {
+			return
+		}
+		reply := target.handleVote(req)
+		t.sim.send(peer, t.from, "VoteReply", func() {
+			if t.sim.nodes[t.from] == t.self {
+				done(reply)
+			}
+		})
+	})
+}
+
+func (t *simTransport) AppendEntries(_ context.Context, peer string, req *proto.AppendRequest, done func(*proto.AppendReply)) {
+	req = gproto.Clone(req).(*proto.AppendRequest)
+	t.sim.send(t.from, peer, "AppendEntries", func() {
+		target := t.sim.nodes[peer]
+		if target == nil {
+			return
+		}
+		reply, err := target.handleAppend(req)
+		if err != nil {
+			return
+		}
+		t.sim.send(peer, t.from, "AppendReply", func() {
+			if t.sim.nodes[t.from] == t.self {
+				done(reply)
+			}
+		})
+	})
+}
+
+func (t *simTransport) InstallSnapshot(_ context.Context, peer string, req *proto.SnapshotRequest, done func(*proto.AppendReply)) {
+	req = gproto.Clone(req).(*proto.SnapshotRequest)
+	t.sim.send(t.from, peer, "InstallSnapshot", func() {
+		target := t.sim.nodes[peer]
+		if target == nil {
+			return
+		}
+		reply, err := target.handleSnapshot(req)
+		if err != nil {
+			return
+		}
+		t.sim.send(peer, t.from, "SnapshotReply", func() {
+			if t.sim.nodes[t.from] == t.self {
+				done(reply)
+			}
+		})
+	})
+}
+
+// simClock only moves when the simulator advances it.
+type simClock struct {
+	now    time.Time
+	timers []simTimer
+}
+
+type simTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *simClock) Now() time.Time { return c.now }
+
+func (c *simClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, simTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *simClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+	waiting := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			waiting = append(waiting, timer)
+		} else {
+			timer.ch <- c.now
+		}
+	}
+	c.timers = waiting
+}
+
+// quiet keeps the replicas' log lines out of the test output.
+func quiet(t *testing.T) {
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { slog.SetDefault(old) })
+}
+
+func TestSimulation(t *testing.T) {
+	quiet(t)
+	seeds := []int64{*simSeed}
+	if *simSeed == 0 {
+		seeds = nil
+		for i := 1; i <= *simSeeds; i++ {
+			seeds = append(seeds, int64(i))
+		}
+	}
+	for _, seed := range seeds {
+		trace, broken := newSimulator(seed, 3).run(*simSteps)
+		if broken != "" {
+			last := trace[max(0, len(trace)-30):]
+			t.Fatalf("seed %d: %s\nreplay with go test -run TestSimulation -sim.seed %d\nlast events:\n%s", seed, broken, seed, strings.Join(last, "\n"))
+		}
+	}
+}
+
+func TestSimulationIsReproducible(t *testing.T) {
+	quiet(t)
+	first, _ := newSimulator(7, 3).run(500)
+	second, _ := newSimulator(7, 3).run(500)
+	if strings.Join(first, "\n") != strings.Join(second, "\n") {
+		t.Fatal("two runs with the same seed took different paths")
+	}
+}
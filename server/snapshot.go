@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	proto "Replication/grpc"
+)
+
+// A replica can compact its log into a snapshot of the state it has applied.
+// log[0] then stands for the snapshot: its term is the snapshot's, and the
+// entries after it follow on from the snapshot's index. A follower that needs
+// entries the leader has compacted away gets the snapshot instead.
+
+// base is the index of log[0], the last entry the snapshot includes.
+func (s *AuctionServer) base() int64 {
+	if s.snapshot == nil {
+		return 0
+	}
+	return s.snapshot.Index
+}
+
+// entry returns the entry at index, which must not be before base.
+func (s *AuctionServer) entry(index int64) *proto.Entry {
+	return s.log[index-s.base()]
+}
+
+// takeSnapshot compacts the log up to the last applied entry and returns
+// how many entries it dropped.
+func (s *AuctionServer) takeSnapshot() int64 {
+	compacted := s.lastApplied - s.base()
+	if compacted == 0 {
+		return 0
+	}
+	snap := s.state()
+	s.log = append([]*proto.Entry{{Term: snap.Term}}, s.log[s.lastApplied-s.base()+1:]...)
+	s.snapshot = snap
+	s.saved(s.store.SaveSnapshot(snap))
+	s.logger.Info("took a snapshot", "index", snap.Index, "compacted", compacted)
+	return compacted
+}
+
+// state captures the state the replica has applied so far.
+func (s *AuctionServer) state() *proto.Snapshot {
+	snap := &proto.Snapshot{
+		Index:       s.lastApplied,
+		Term:        s.entry(s.lastApplied).Term,
+		Auctions:    s.auctionStates(),
+		Bidders:     maps.Clone(s.bidders),
+		LamportTime: s.lamportTime,
+		Webhooks:    s.webhookList(),
+		Deliveries:  slices.Clone(s.deliveries),
+		Audit:       s.auditRecords(),
+		Hash:        s.hashAt(s.lastApplied),
+	}
+	return snap
+}
+
+// auctionStates lists the auctions, sorted by name.
+func (s *AuctionServer) auctionStates() []*proto.AuctionState {
+	var states []*proto.AuctionState
+	for _, id := range slices.Sorted(maps.Keys(s.auctions)) {
+		a := s.auctions[id]
+		states = append(states, &proto.AuctionState{
+			Auction:          id,
+			HighestBid:       a.highestBid,
+			HighestBidder:    a.highestBidder,
+			HighestTimestamp: a.highestTS,
+			Over:             a.isAuctionOver,
+			Deadline:         a.deadline,
+			Currency:         a.currency,
+		})
+	}
+	return states
+}
+
+// restore replaces the applied state with the snapshot's.
+func (s *AuctionServer) restore(snap *proto.Snapshot) {
+	s.auctions = make(map[string]*auction)
+	for _, a := range snap.Auctions {
+		s.auctions[a.Auction] = &auction{
+			highestBid:    a.HighestBid,
+			highestBidder: a.HighestBidder,
+			highestTS:     a.HighestTimestamp,
+			isAuctionOver: a.Over,
+			deadline:      a.Deadline,
+			currency:      a.Currency,
+		}
+	}
+	s.bidders = maps.Clone(snap.Bidders)
+	if s.bidders == nil {
+		s.bidders = make(map[string]string)
+	}
+	s.lamportTime = snap.LamportTime
+	s.webhooks = make(map[string]*proto.Webhook)
+	for _, hook := range snap.Webhooks {
+		s.webhooks[hook.Url] = hook
+	}
+	s.deliveries = slices.Clone(snap.Deliveries)
+	s.attempts = make(map[string]*attempt)
+	s.trails = make(map[string][]*proto.AuditRecord)
+	for _, rec := range snap.Audit {
+		s.trails[rec.Auction] = append(s.trails[rec.Auction], rec)
+	}
+}
+
+func (s *AuctionServer) sendSnapshot(peer string) {
+	req := &proto.SnapshotRequest{
+		Term:         s.term,
+		Leader:       s.id,
+		Snapshot:     s.snapshot,
+		LeaderCommit: s.commitIndex,
+	}
+	s.transport.InstallSnapshot(context.Background(), peer, req, func(reply *proto.AppendReply) {
+		s.handleSnapshotReply(peer, req, reply)
+	})
+}
+
+func (s *AuctionServer) handleSnapshotReply(peer string, req *proto.SnapshotRequest, reply *proto.AppendReply) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if reply.Term > s.term {
+		s.becomeFollower(reply.Term, "")
+		return
+	}
+	if s.role != leader || s.term != req.Term || !reply.Success {
+		return
+	}
+	s.heard[peer] = 0
+
+	if match := req.Snapshot.Index; match > s.matchIndex[peer] {
+		s.matchIndex[peer] = match
+		s.nextIndex[peer] = match + 1
+		s.maybeCommit()
+	}
+	if s.nextIndex[peer] <= s.lastIndex() {
+		s.sendAppend(peer)
+	}
+}
+
+// handleSnapshot installs the leader's snapshot. Entries after it that agree
+// with it are kept, the rest of the log is dropped.
+func (s *AuctionServer) handleSnapshot(req *proto.SnapshotRequest) (*proto.AppendReply, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.asked != nil {
+		return nil, errRecovering
+	}
+	if req.Term < s.term {
+		return &proto.AppendReply{Term: s.term, LastLogIndex: s.lastIndex()}, nil
+	}
+	s.becomeFollower(req.Term, req.Leader)
+
+	snap := req.Snapshot
+	if snap.Index > s.commitIndex {
+		if snap.Index <= s.lastIndex() && s.entry(snap.Index).Term == snap.Term {
+			s.log = append([]*proto.Entry{{Term: snap.Term}}, s.log[snap.Index-s.base()+1:]...)
+		} else {
+			s.truncate(s.commitIndex + 1)
+			s.log = []*proto.Entry{{Term: snap.Term}}
+		}
+		// requests for entries the snapshot covers never learn their outcome
+		for index, w := range s.waiting {
+			if index <= snap.Index {
+				close(w.ch)
+				delete(s.waiting, index)
+			}
+		}
+		s.restore(snap)
+		s.snapshot = snap
+		s.saved(s.store.SaveSnapshot(snap))
+		s.commitIndex, s.lastApplied = snap.Index, snap.Index
+		s.publishStates()
+		s.logger.Info("installed a snapshot", "index", snap.Index)
+	}
+	if s.lastIndex() >= req.LeaderCommit {
+		s.recovering = false
+	}
+	return &proto.AppendReply{Term: s.term, Success: true, LastLogIndex: s.lastIndex()}, nil
+}
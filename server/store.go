@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	proto "Replication/grpc"
+)
+
+// A replica saves its term, its vote, its log and its snapshot to a Store
+// before it answers for them, so that after a restart it still knows what
+// it promised the others. The auctions, bidders and the rest of the state
+// follow from the snapshot and the log. Which store to use is a trade-off:
+//   - memory keeps nothing across a restart, the replica recovers from the
+//     others instead, see askTerm. Fast, but only one replica at a time may
+//     be without its state.
+//   - file appends every change to a file and syncs it. Simple and durable,
+//     the file is rewritten when the log is compacted.
+//   - bolt keeps the log in a bbolt database, indexed by position, so
+//     compacting and truncating do not rewrite everything.
+
+// Store saves what a replica must not forget.
+type Store interface {
+	// Load returns what was saved, empty if nothing was.
+	Load() (Saved, error)
+	// SaveState saves the term and the vote in it.
+	SaveState(term int64, votedFor string) error
+	// Append saves entries from index on, dropping any saved there before.
+	Append(index int64, entries []*proto.Entry) error
+	// Truncate drops the entries from index on.
+	Truncate(index int64) error
+	// SaveSnapshot saves the snapshot and drops the entries it includes.
+	SaveSnapshot(snap *proto.Snapshot) error
+	Close() error
+}
+
+// Saved is what a Store has saved.
+type Saved struct {
+	Term     int64
+	VotedFor string
+	Snapshot *proto.Snapshot // nil if the log was never compacted
+	Entries  []*proto.Entry  // the log after the snapshot
+}
+
+func (s Saved) empty() bool {
+	return s.Term == 0 && s.Snapshot == nil && len(s.Entries) == 0
+}
+
+// openStore opens a store of the given kind: memory, file or bolt. path is
+// where the file and bolt stores keep their data.
+func openStore(kind, path string) (Store, error) {
+	switch kind {
+	case "memory":
+		return &memoryStore{}, nil
+	case "file":
+		return openFileStore(path)
+	case "bolt":
+		return openBoltStore(path)
+	}
+	return nil, fmt.Errorf("unknown store %q, want memory, file or bolt", kind)
+}
+
+// memoryStore keeps what it saves in memory only, which is how replicas
+// have always worked: a restarted process starts with an empty one. The
+// tests keep one across restarts to stand in for a durable store.
+type memoryStore struct {
+	saved Saved
+}
+
+func (m *memoryStore) Load() (Saved, error) {
+	saved := m.saved
+	saved.Entries = append([]*proto.Entry(nil), m.saved.Entries...)
+	return saved, nil
+}
+
+func (m *memoryStore) SaveState(term int64, votedFor string) error {
+	m.saved.Term, m.saved.VotedFor = term, votedFor
+	return nil
+}
+
+// first is the index of Entries[0].
+func (m *memoryStore) first() int64 {
+	if m.saved.Snapshot == nil {
+		return 1
+	}
+	return m.saved.Snapshot.Index + 1
+}
+
+func (m *memoryStore) Append(index int64, entries []*proto.Entry) error {
+	if err := m.Truncate(index); err != nil {
+		return err
+	}
+	m.saved.Entries = append(m.saved.Entries, entries...)
+	return nil
+}
+
+func (m *memoryStore) Truncate(index int64) error {
+	last := m.first() + int64(len(m.saved.Entries))
+	if index < m.first() || index > last {
+		return fmt.Errorf("cannot cut the log at %d, it holds entries %d to %d", index, m.first(), last-1)
+	}
+	m.saved.Entries = m.saved.Entries[:index-m.first()]
+	return nil
+}
+
+func (m *memoryStore) SaveSnapshot(snap *proto.Snapshot) error {
+	keep := snap.Index + 1 - m.first()
+	if keep >= int64(len(m.saved.Entries)) {
+		m.saved.Entries = nil
+	} else if keep > 0 {
+		m.saved.Entries = m.saved.Entries[keep:]
+	}
+	m.saved.Snapshot = snap
+	return nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+// UseStore loads what store has saved and saves to it from then on. It has
+// to be called before Start. A replica that finds its state does not need
+// to recover it from the others.
+func (s *AuctionServer) UseStore(store Store) error {
+	saved, err := store.Load()
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.store = store
+	if saved.empty() {
+		return nil
+	}
+	s.term, s.votedFor = saved.Term, saved.VotedFor
+	s.log = []*proto.Entry{{}}
+	if snap := saved.Snapshot; snap != nil {
+		s.log[0].Term = snap.Term
+		s.restore(snap)
+		s.snapshot = snap
+		s.commitIndex, s.lastApplied = snap.Index, snap.Index
+	}
+	s.log = append(s.log, saved.Entries...)
+	s.asked, s.recovering = nil, false
+	s.show()
+	s.logger.Info("loaded the saved state", "snapshot", s.base(), "last", s.lastIndex())
+	return nil
+}
+
+// saved stops the process if the store failed. A replica that went on could
+// forget a vote it gave or an entry it told the leader it has.
+func (s *AuctionServer) saved(err error) {
+	if err == nil {
+		return
+	}
+	select {
+	case <-s.done:
+		// the store may be closed already
+		return
+	default:
+	}
+	s.logger.Error("failed to save", "err", err)
+	os.Exit(1)
+}
+
+func (s *AuctionServer) saveState() {
+	s.saved(s.store.SaveState(s.term, s.votedFor))
+}
+
+// saveEntries saves entries, which end the log.
+func (s *AuctionServer) saveEntries(entries ...*proto.Entry) {
+	if len(entries) > 0 {
+		s.saved(s.store.Append(s.lastIndex()-int64(len(entries))+1, entries))
+	}
+}
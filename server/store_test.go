@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	proto "Replication/grpc"
+
+	gproto "google.golang.org/protobuf/proto"
+)
+
+func bidEntry(term, amount int64) *proto.Entry {
+	return &proto.Entry{Term: term, Op: &proto.Entry_Bid{Bid: &proto.Amount{Amount: amount, Bidder: "Anna"}}}
+}
+
+// fill saves a history with a truncated tail and a snapshot. What is left is
+// the snapshot at 2 and entries 3 and 4.
+func fill(t *testing.T, store Store) {
+	t.Helper()
+	steps := []error{
+		store.SaveState(1, "node-0"),
+		store.Append(1, []*proto.Entry{bidEntry(1, 1), bidEntry(1, 2), bidEntry(1, 3)}),
+		store.SaveState(2, ""),
+		store.Append(3, []*proto.Entry{bidEntry(2, 30), bidEntry(2, 40)}),
+		store.SaveSnapshot(&proto.Snapshot{Index: 2, Term: 1, LamportTime: 7}),
+		store.Append(5, []*proto.Entry{bidEntry(2, 50)}),
+		store.Truncate(5),
+		store.SaveState(3, "node-1"),
+	}
+	for i, err := range steps {
+		if err != nil {
+			t.Fatalf("step %d: %v", i+1, err)
+		}
+	}
+}
+
+func checkSaved(t *testing.T, saved Saved) {
+	t.Helper()
+	if saved.Term != 3 || saved.VotedFor != "node-1" {
+		t.Errorf("term %d, vote %q, want 3 and node-1", saved.Term, saved.VotedFor)
+	}
+	if saved.Snapshot == nil || saved.Snapshot.Index != 2 || saved.Snapshot.LamportTime != 7 {
+		t.Errorf("snapshot %v, want the one at 2", saved.Snapshot)
+	}
+	want := []*proto.Entry{bidEntry(2, 30), bidEntry(2, 40)}
+	if len(saved.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(saved.Entries), len(want))
+	}
+	for i := range want {
+		if !gproto.Equal(saved.Entries[i], want[i]) {
+			t.Errorf("entry %d: got %v, want %v", i+3, saved.Entries[i], want[i])
+		}
+	}
+}
+
+func TestStoresKeepTheLog(t *testing.T) {
+	dir := t.TempDir()
+	for _, kind := range []string{"memory", "file", "bolt"} {
+		path := filepath.Join(dir, kind)
+		store, err := openStore(kind, path)
+		if err != nil {
+			t.Fatalf("%s: open: %v", kind, err)
+		}
+		fill(t, store)
+		saved, err := store.Load()
+		if err != nil {
+			t.Fatalf("%s: load: %v", kind, err)
+		}
+		checkSaved(t, saved)
+		store.Close()
+		if kind == "memory" {
+			continue
+		}
+
+		store, err = openStore(kind, path)
+		if err != nil {
+			t.Fatalf("%s: reopen: %v", kind, err)
+		}
+		saved, err = store.Load()
+		if err != nil {
+			t.Fatalf("%s: load after reopening: %v", kind, err)
+		}
+		checkSaved(t, saved)
+		store.Close()
+	}
+}
+
+func TestFileStoreDropsTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	store, err := openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, store)
+	store.Close()
+
+	// a crash in the middle of writing the last record
+	before, _ := os.Stat(path)
+	store, _ = openFileStore(path)
+	store.Append(5, []*proto.Entry{bidEntry(3, 60)})
+	store.Close()
+	if err := os.Truncate(path, before.Size()+5); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = openFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	saved, _ := store.Load()
+	checkSaved(t, saved)
+	// the file takes records again where the whole ones end
+	if err := store.Append(5, []*proto.Entry{bidEntry(3, 60)}); err != nil {
+		t.Fatal(err)
+	}
+	again, err := openFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen after appending: %v", err)
+	}
+	if saved, _ := again.Load(); len(saved.Entries) != 3 {
+		t.Errorf("got %d entries after appending, want 3", len(saved.Entries))
+	}
+	again.Close()
+
+	// a flipped bit in the first record, with whole records after it, is
+	// damage rather than a crash, and the records after it must not be lost
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[10] ^= 1
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openFileStore(path); err == nil {
+		t.Fatal("opened a file with a damaged record in the middle")
+	}
+	if after, _ := os.ReadFile(path); len(after) != len(data) {
+		t.Errorf("file went from %d to %d bytes, want it left alone", len(data), len(after))
+	}
+}
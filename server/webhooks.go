@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	proto "Replication/grpc"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Webhooks tell other systems when a bidder is outbid, when an auction
+// closes and who won it. Webhooks are registered through the log, and
+// applying a bid or close adds a delivery for every matching webhook, so all
+// replicas know which deliveries are pending. Only the leader sends them.
+// Once a receiver answers with a 2xx status the leader puts a Delivered entry
+// in the log and no replica sends that delivery again. A leader that fails in
+// between leaves the delivery to the next one, which sends it with the same
+// ID, so receivers should ignore IDs they have already seen.
+
+const (
+	webhookPoll     = 100 * time.Millisecond // how often the leader looks for due deliveries
+	webhookTimeout  = 5 * time.Second
+	webhookRetry    = 250 * time.Millisecond // wait before the first retry, doubling after every failure
+	webhookMaxRetry = time.Minute
+	webhookAttempts = 20 // failures before the leader gives up on a delivery
+)
+
+var webhookEvents = []string{"outbid", "closed", "winner"}
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookPayload is the JSON body of a webhook call. For outbid, bidder is
+// the bidder who lost the lead and outbidBy the one who took it; for closed
+// and winner, bidder is the highest bidder. amount is the highest bid, in
+// minor units of currency.
+type webhookPayload struct {
+	ID       string `json:"id"`
+	Event    string `json:"event"`
+	Auction  string `json:"auction"`
+	Bidder   string `json:"bidder,omitempty"`
+	OutbidBy string `json:"outbidBy,omitempty"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// attempt is how the leader's tries at one delivery went so far.
+type attempt struct {
+	failures  int
+	next      time.Time // no retry before
+	sending   bool
+	delivered bool // or given up on, and waiting for the Delivered entry to commit
+	failed    bool
+}
+
+func (s *AuctionServer) AddWebhook(ctx context.Context, req *proto.Webhook) (*proto.Ack, error) {
+	if u, err := url.Parse(req.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "%q is not an http or https URL", req.Url)
+	}
+	if req.Secret == "" {
+		return nil, status.Error(codes.InvalidArgument, "a webhook needs a secret to sign its payloads with")
+	}
+	for _, event := range req.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown event %q, want outbid, closed or winner", event)
+		}
+	}
+
+	hook := &proto.Webhook{Url: req.Url, Secret: req.Secret, Events: req.Events, Auction: req.Auction}
+	ack, err := s.propose(ctx, &proto.Entry{Op: &proto.Entry_AddWebhook{AddWebhook: hook}})
+	if errors.Is(err, errNotLeader) {
+		client, err := s.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return client.AddWebhook(ctx, req)
+	}
+	if err != nil {
+		return nil, replicationError(err)
+	}
+	return &proto.Ack{Ack: ack}, nil
+}
+
+func (s *AuctionServer) RemoveWebhook(ctx context.Context, req *proto.Webhook) (*proto.Ack, error) {
+	ack, err := s.propose(ctx, &proto.Entry{Op: &proto.Entry_RemoveWebhook{RemoveWebhook: &proto.Webhook{Url: req.Url}}})
+	if errors.Is(err, errNotLeader) {
+		client, err := s.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return client.RemoveWebhook(ctx, req)
+	}
+	if err != nil {
+		return nil, replicationError(err)
+	}
+	if ack == "unknown" {
+		return nil, status.Errorf(codes.NotFound, "no webhook for %s", req.Url)
+	}
+	return &proto.Ack{Ack: ack}, nil
+}
+
+// ListWebhooks answers from this replica's state, which may be a little
+// behind the leader's.
+func (s *AuctionServer) ListWebhooks(ctx context.Context, _ *proto.Empty) (*proto.WebhookList, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	list := &proto.WebhookList{}
+	for _, hook := range s.webhookList() {
+		list.Webhooks = append(list.Webhooks, &proto.Webhook{Url: hook.Url, Events: hook.Events, Auction: hook.Auction})
+	}
+	return list, nil
+}
+
+// webhookList returns the webhooks sorted by URL.
+func (s *AuctionServer) webhookList() []*proto.Webhook {
+	var hooks []*proto.Webhook
+	for _, u := range slices.Sorted(maps.Keys(s.webhooks)) {
+		hooks = append(hooks, s.webhooks[u])
+	}
+	return hooks
+}
+
+func (s *AuctionServer) applyAddWebhook(hook *proto.Webhook) string {
+	s.webhooks[hook.Url] = hook
+	s.logger.Info("webhook added", "url", hook.Url)
+	return "success"
+}
+
+// applyRemoveWebhook also drops the webhook's pending deliveries.
+func (s *AuctionServer) applyRemoveWebhook(hook *proto.Webhook) string {
+	if _, ok := s.webhooks[hook.Url]; !ok {
+		return "unknown"
+	}
+	delete(s.webhooks, hook.Url)
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(d *proto.Delivery) bool { return d.Url == hook.Url })
+	s.logger.Info("webhook removed", "url", hook.Url)
+	return "success"
+}
+
+func (s *AuctionServer) applyDelivered(done *proto.Delivered) string {
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(d *proto.Delivery) bool {
+		return d.Id == done.Id && d.Url == done.Url
+	})
+	delete(s.attempts, done.Id+" "+done.Url)
+	return "success"
+}
+
+// notify adds a delivery of p for every webhook that wants it. The event's
+// ID is made of the index of the entry being applied and the event, so it
+// is the same on every replica.
+func (s *AuctionServer) notify(p webhookPayload) {
+	p.ID = fmt.Sprintf("%d-%s", s.lastApplied, p.Event)
+	var body []byte
+	for _, hook := range s.webhookList() {
+		if hook.Auction != "" && hook.Auction != p.Auction || len(hook.Events) > 0 && !slices.Contains(hook.Events, p.Event) {
+			continue
+		}
+		if body == nil {
+			body, _ = json.Marshal(p)
+		}
+		s.deliveries = append(s.deliveries, &proto.Delivery{Id: p.ID, Url: hook.Url, Event: p.Event, Body: body})
+	}
+}
+
+// sendWebhooks has the leader send the deliveries that are due, until the
+// replica stops.
+func (s *AuctionServer) sendWebhooks() {
+	for {
+		select {
+		case <-s.clock.After(webhookPoll):
+		case <-s.done:
+			return
+		}
+
+		s.mutex.Lock()
+		// a new leader first has to apply the Delivered entries of the
+		// terms before, which it has done once it applied an entry of its own
+		if s.role != leader || s.entry(s.lastApplied).Term != s.term {
+			s.mutex.Unlock()
+			continue
+		}
+		now := s.clock.Now()
+		for _, d := range s.deliveries {
+			key := d.Id + " " + d.Url
+			a := s.attempts[key]
+			if a == nil {
+				a = &attempt{}
+				s.attempts[key] = a
+			}
+			if a.sending || now.Before(a.next) {
+				continue
+			}
+			a.sending = true
+			if a.delivered {
+				go s.markDelivered(d, a)
+			} else {
+				go s.deliver(d, s.webhooks[d.Url].Secret, a)
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// deliver sends d once and records how it went.
+func (s *AuctionServer) deliver(d *proto.Delivery, secret string, a *attempt) {
+	err := postWebhook(d, secret)
+
+	s.mutex.Lock()
+	switch {
+	case err == nil:
+		a.delivered = true
+		s.metrics.webhooks.WithLabelValues("delivered").Inc()
+		s.logger.Debug("webhook delivered", "url", d.Url, "id", d.Id)
+	case a.failures+1 >= webhookAttempts:
+		a.delivered, a.failed = true, true
+		s.metrics.webhooks.WithLabelValues("given_up").Inc()
+		s.logger.Warn("gave up on a webhook", "url", d.Url, "id", d.Id, "err", err)
+	default:
+		a.failures++
+		a.next = s.clock.Now().Add(min(webhookRetry<<(a.failures-1), webhookMaxRetry))
+		s.metrics.webhooks.WithLabelValues("failed").Inc()
+		s.logger.Warn("webhook failed", "url", d.Url, "id", d.Id, "failures", a.failures, "err", err)
+	}
+	done := a.delivered
+	s.mutex.Unlock()
+
+	if done {
+		s.markDelivered(d, a)
+	} else {
+		s.mutex.Lock()
+		a.sending = false
+		s.mutex.Unlock()
+	}
+}
+
+// markDelivered puts a Delivered entry for d in the log. If that fails the
+// leader tries again on its next round, without sending d again.
+func (s *AuctionServer) markDelivered(d *proto.Delivery, a *attempt) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	s.mutex.Lock()
+	failed := a.failed
+	s.mutex.Unlock()
+	s.propose(ctx, &proto.Entry{Op: &proto.Entry_Delivered{Delivered: &proto.Delivered{Id: d.Id, Url: d.Url, Failed: failed}}})
+
+	s.mutex.Lock()
+	a.sending = false
+	s.mutex.Unlock()
+}
+
+// postWebhook POSTs the delivery's body, signed with secret in the
+// X-Webhook-Signature header.
+func postWebhook(d *proto.Delivery, secret string) error {
+	req, err := http.NewRequest("POST", d.Url, bytes.NewReader(d.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", d.Id)
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Signature", "sha256="+sign(secret, d.Body))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("answered %s", resp.Status)
+	}
+	return nil
+}
+
+// sign returns the hex HMAC-SHA256 of body.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
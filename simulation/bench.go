@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	proto "Replication/grpc"
+	"Replication/launcher"
+	"Replication/security"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// benchConfig is what a benchmark runs with.
+type benchConfig struct {
+	servers  []string
+	bidders  int
+	rate     float64 // bids per second over all bidders
+	duration time.Duration
+	auction  string
+	dialOpt  grpc.DialOption
+}
+
+// benchReport is printed at the end and written as JSON with -json.
+type benchReport struct {
+	Servers    []string         `json:"servers"`
+	Bidders    int              `json:"bidders"`
+	TargetRate float64          `json:"targetRate"`
+	Seconds    float64          `json:"seconds"`
+	Throughput float64          `json:"throughput"` // answered bids per second
+	Total      replicaReport    `json:"total"`
+	Replicas   []*replicaReport `json:"replicas"`
+}
+
+// replicaReport counts the bids sent to one replica, or to all of them.
+type replicaReport struct {
+	Addr     string         `json:"addr,omitempty"`
+	Sent     int            `json:"sent"`
+	Accepted int            `json:"accepted"`
+	Rejected map[string]int `json:"rejected"` // answered, but not accepted, by answer
+	Errors   map[string]int `json:"errors"`   // by gRPC code
+	// RejectionRate is the share of answered bids that were not accepted.
+	RejectionRate float64 `json:"rejectionRate"`
+	Latency       latency `json:"latencyMillis"`
+
+	latencies []time.Duration
+}
+
+type latency struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+func newReplicaReport(addr string) *replicaReport {
+	return &replicaReport{Addr: addr, Rejected: make(map[string]int), Errors: make(map[string]int)}
+}
+
+// add counts one bid. Errors do not count towards the latencies.
+func (r *replicaReport) add(took time.Duration, ack *proto.Ack, err error) {
+	r.Sent++
+	switch {
+	case err != nil:
+		r.Errors[status.Code(err).String()]++
+		return
+	case ack.Ack == "success":
+		r.Accepted++
+	default:
+		r.Rejected[ack.Ack]++
+	}
+	r.latencies = append(r.latencies, took)
+}
+
+func (r *replicaReport) finish() {
+	answered := r.Accepted
+	for _, n := range r.Rejected {
+		answered += n
+	}
+	if answered > 0 {
+		r.RejectionRate = float64(answered-r.Accepted) / float64(answered)
+	}
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	r.Latency = latency{
+		P50: millis(percentile(r.latencies, 50)),
+		P95: millis(percentile(r.latencies, 95)),
+		P99: millis(percentile(r.latencies, 99)),
+		Max: millis(percentile(r.latencies, 100)),
+	}
+}
+
+// percentile of sorted durations, by the nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// bench is the bench subcommand.
+func bench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	servers := fs.String("servers", "", "Comma-separated addresses of a running cluster. Without it a cluster of -nodes is started")
+	nodes := fs.Int("nodes", 3, "Size of the cluster to start")
+	bidders := fs.Int("bidders", 10, "Bidders bidding at the same time")
+	rate := fs.Float64("rate", 50, "Bids per second over all bidders")
+	duration := fs.Duration("duration", 10*time.Second, "How long to bid")
+	auction := fs.String("auction", "", "Auction to bid in, the servers' default auction if empty")
+	jsonOut := fs.String("json", "", "Write the report as JSON to this file, - for standard output")
+	caFile := fs.String("ca", "", "CA that signed the server certificates, turns on TLS")
+	serverName := fs.String("server-name", "localhost", "Name in the server certificates")
+	fs.Parse(args)
+
+	if *bidders < 1 || *rate <= 0 {
+		log.Fatal("-bidders and -rate must be positive")
+	}
+	dialOpt, err := security.TLSFiles{CA: *caFile, ServerName: *serverName}.DialOption()
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+
+	cfg := benchConfig{
+		bidders:  *bidders,
+		rate:     *rate,
+		duration: *duration,
+		auction:  *auction,
+		dialOpt:  dialOpt,
+	}
+	// cleanup runs before anything can exit, as log.Fatal skips deferred calls
+	cleanup := func() {}
+	if *servers != "" {
+		cfg.servers = strings.Split(*servers, ",")
+	} else {
+		var cluster *launcher.Cluster
+		cluster, cleanup = startBenchCluster(*nodes)
+		cfg.servers = cluster.Addrs
+	}
+
+	report, err := runBench(cfg)
+	cleanup()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *jsonOut != "-" {
+		report.print(os.Stdout)
+	}
+	if *jsonOut != "" {
+		out := os.Stdout
+		if *jsonOut != "-" {
+			out, err = os.Create(*jsonOut)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer out.Close()
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// startBenchCluster starts n servers without rate limits, since all bidders
+// of the benchmark share one address.
+func startBenchCluster(n int) (*launcher.Cluster, func()) {
+	work, err := os.MkdirTemp("", "bench")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cluster := launcher.New(serverBinary(work), work, n, *basePort, "-bid-rate", "0", "-addr-rate", "0")
+	if !*verbose {
+		cluster.Output = io.Discard
+	}
+	if err := cluster.StartAll(); err != nil {
+		cluster.StopAll(5 * time.Second)
+		log.Fatal(err)
+	}
+	return cluster, func() {
+		cluster.StopAll(5 * time.Second)
+		os.RemoveAll(work)
+	}
+}
+
+// benchBidder bids through one replica only, so errors show up under the
+// replica that caused them.
+type benchBidder struct {
+	name    string
+	token   string
+	replica int
+	call    []grpc.CallOption
+}
+
+func runBench(cfg benchConfig) (*benchReport, error) {
+	var clients []proto.AuctionServerClient
+	for _, addr := range cfg.servers {
+		conn, err := grpc.Dial(strings.TrimSpace(addr), cfg.dialOpt)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		clients = append(clients, proto.NewAuctionServerClient(conn))
+	}
+
+	// a unique prefix lets the benchmark run again against the same cluster
+	prefix := fmt.Sprintf("bench-%d", time.Now().UnixNano())
+	var bidders []*benchBidder
+	for i := 0; i < cfg.bidders; i++ {
+		b := &benchBidder{name: fmt.Sprintf("%s-%d", prefix, i), replica: i % len(clients)}
+		err := retry(startTimeout, func(ctx context.Context) error {
+			creds, err := clients[b.replica].Register(ctx, &proto.Registration{Bidder: b.name})
+			if err == nil {
+				b.token = creds.Token
+				if creds.AccessToken != "" {
+					b.call = append(b.call, grpc.PerRPCCredentials(security.NewBearerToken(creds.AccessToken)))
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("register %s: %w", b.name, err)
+		}
+		bidders = append(bidders, b)
+	}
+
+	report := &benchReport{
+		Servers:    cfg.servers,
+		Bidders:    cfg.bidders,
+		TargetRate: cfg.rate,
+		Total:      *newReplicaReport(""),
+	}
+	for _, addr := range cfg.servers {
+		report.Replicas = append(report.Replicas, newReplicaReport(addr))
+	}
+
+	var (
+		mutex  sync.Mutex
+		amount atomic.Int64
+		wg     sync.WaitGroup
+	)
+	// every bidder sends its share of the rate, paced from the start so a
+	// slow answer does not lower the rate for long
+	interval := time.Duration(float64(time.Second) * float64(cfg.bidders) / cfg.rate)
+	start := time.Now()
+	end := start.Add(cfg.duration)
+	for i, b := range bidders {
+		wg.Add(1)
+		go func(b *benchBidder, offset time.Duration) {
+			defer wg.Done()
+			for next := start.Add(offset); next.Before(end); next = next.Add(interval) {
+				time.Sleep(time.Until(next))
+				ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+				sent := time.Now()
+				ack, err := clients[b.replica].Bid(ctx, &proto.Amount{
+					Amount:    amount.Add(1),
+					Bidder:    b.name,
+					Timestamp: int32(sent.UnixNano()),
+					Token:     b.token,
+					Auction:   cfg.auction,
+				}, b.call...)
+				took := time.Since(sent)
+				cancel()
+
+				mutex.Lock()
+				report.Total.add(took, ack, err)
+				report.Replicas[b.replica].add(took, ack, err)
+				mutex.Unlock()
+			}
+		}(b, interval*time.Duration(i)/time.Duration(cfg.bidders))
+	}
+	wg.Wait()
+
+	report.Seconds = time.Since(start).Seconds()
+	report.Total.finish()
+	for _, r := range report.Replicas {
+		r.finish()
+	}
+	answered := report.Total.Sent
+	for _, n := range report.Total.Errors {
+		answered -= n
+	}
+	report.Throughput = float64(answered) / report.Seconds
+	return report, nil
+}
+
+func (r *benchReport) print(w io.Writer) {
+	fmt.Fprintf(w, "%d bidders at %.1f bids/s for %.1fs: %.1f answered bids/s\n\n", r.Bidders, r.TargetRate, r.Seconds, r.Throughput)
+	fmt.Fprintf(w, "%-16s %7s %9s %9s %8s %8s %8s %8s  %s\n", "replica", "sent", "accepted", "rejected", "p50 ms", "p95 ms", "p99 ms", "max ms", "errors")
+	for _, rep := range append(r.Replicas, &r.Total) {
+		addr := rep.Addr
+		if addr == "" {
+			addr = "total"
+		}
+		fmt.Fprintf(w, "%-16s %7d %9d %8.1f%% %8.1f %8.1f %8.1f %8.1f  %v\n",
+			addr, rep.Sent, rep.Accepted, 100*rep.RejectionRate,
+			rep.Latency.P50, rep.Latency.P95, rep.Latency.P99, rep.Latency.Max, counts(rep.Errors))
+	}
+}
+
+// counts formats counts like "DeadlineExceeded=2 Unavailable=5".
+func counts(m map[string]int) string {
+	if len(m) == 0 {
+		return "-"
+	}
+	var parts []string
+	for k, n := range m {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
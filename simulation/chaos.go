@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// chaosConfig is what the chaos controller makes up a scenario from.
+type chaosConfig struct {
+	nodes    int
+	bidders  int
+	every    time.Duration // between two bids of one bidder
+	duration time.Duration
+	down     time.Duration // how long a replica stays down, on average
+	gap      time.Duration // at least between a restart and the next fault
+	kill     float64       // share of faults that are SIGKILL instead of SIGTERM
+}
+
+// chaos is the chaos subcommand. It makes up a scenario in which replicas
+// are stopped or killed and restarted at random while bidders keep bidding,
+// and plays it like any other.
+func chaos(args []string) {
+	fs := flag.NewFlagSet("chaos", flag.ExitOnError)
+	nodes := fs.Int("nodes", 3, "Size of the cluster")
+	bidders := fs.Int("bidders", 3, "Bidders bidding at the same time")
+	every := fs.Duration("every", 200*time.Millisecond, "Time between two bids of one bidder")
+	duration := fs.Duration("duration", 30*time.Second, "How long to bid")
+	down := fs.Duration("down", time.Second, "How long a replica stays down, on average")
+	gap := fs.Duration("gap", 3*time.Second, "Least time between a restart and the next fault, for the replica to catch up")
+	kill := fs.Float64("kill", 0.5, "Share of faults that are SIGKILL rather than SIGTERM")
+	seed := fs.Int64("seed", 0, "Seed for the schedule, random if 0")
+	save := fs.String("save", "", "Also write the scenario to this file, to play it again")
+	fs.Parse(args)
+
+	if *nodes < 1 || *bidders < 1 || *every <= 0 || *gap <= 0 {
+		log.Fatal("-nodes, -bidders, -every and -gap must be positive")
+	}
+	if *down < 0 {
+		log.Fatal("-down must not be negative")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	sc := chaosScenario(rand.New(rand.NewSource(*seed)), chaosConfig{
+		nodes:    *nodes,
+		bidders:  *bidders,
+		every:    *every,
+		duration: *duration,
+		down:     *down,
+		gap:      *gap,
+		kill:     *kill,
+	})
+	sc.Name = fmt.Sprintf("chaos with seed %d", *seed)
+	if *save != "" {
+		data, err := json.MarshalIndent(sc, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(*save, append(data, '\n'), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	work, err := os.MkdirTemp("", "chaos")
+	if err != nil {
+		log.Fatal(err)
+	}
+	dir := filepath.Join(work, "chaos")
+	ok, err := runScenario(sc, serverBinary(work), dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !ok {
+		fmt.Printf("the servers' logs are in %s\nrun the same schedule again with chaos -seed %d\n", dir, *seed)
+		os.Exit(1)
+	}
+	os.RemoveAll(work)
+}
+
+// chaosScenario makes up the scenario. Only one replica is down at a time,
+// and it gets time to catch up before the next fault, as a replica started
+// with -store memory, the default, loses its state when it restarts.
+func chaosScenario(rnd *rand.Rand, cfg chaosConfig) *Scenario {
+	sc := &Scenario{Nodes: cfg.nodes, Settle: Duration{10 * time.Second}}
+
+	// bidders raise in steps of the number of bidders, so no two bids are
+	// the same and an acknowledged bid can always be told apart
+	times := int(cfg.duration / cfg.every)
+	for i := 0; i < cfg.bidders; i++ {
+		sc.Bidders = append(sc.Bidders, Bidder{
+			Name: fmt.Sprintf("bidder%d", i),
+			Bids: []Bid{{
+				At:     Duration{cfg.every * time.Duration(i) / time.Duration(cfg.bidders)},
+				Amount: int64(i + 1),
+				Every:  Duration{cfg.every},
+				Times:  max(times, 1),
+				Raise:  int64(cfg.bidders),
+				Via:    i % cfg.nodes,
+			}},
+		})
+	}
+
+	if cfg.nodes < 2 {
+		return sc
+	}
+	jitter := func(d time.Duration) time.Duration {
+		return d/2 + time.Duration(rnd.Int63n(int64(d)+1))
+	}
+	for at := jitter(cfg.gap); at < cfg.duration; {
+		node := rnd.Intn(cfg.nodes)
+		action := "stop"
+		if rnd.Float64() < cfg.kill {
+			action = "crash"
+		}
+		restart := at + jitter(cfg.down)
+		sc.Events = append(sc.Events,
+			Event{At: Duration{at}, Action: action, Node: node},
+			Event{At: Duration{restart}, Action: "restart", Node: node},
+		)
+		at = restart + cfg.gap + jitter(cfg.gap)/2
+	}
+	return sc
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"Replication/launcher"
+)
+
+var (
+	serverBin = flag.String("server-bin", "", "Server binary to run, built from ../server if empty")
+	basePort  = flag.Int("base-port", 50061, "Port of the first node, the others use the ports after it")
+	histories = flag.String("histories", "", "Directory to write each scenario's history to, for the checker")
+	verbose   = flag.Bool("v", false, "Show the servers' output")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `usage: go run . [flags] scenario.json...
+       go run . [flags] bench [bench flags]
+       go run . [flags] chaos [chaos flags]
+
+The first form runs each scenario against a fresh local cluster and reports
+whether its invariants held. bench measures throughput and latency, see
+go run . bench -h. chaos kills and restarts replicas at random while
+bidders bid, see go run . chaos -h.
+
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	switch flag.Arg(0) {
+	case "bench":
+		bench(flag.Args()[1:])
+		return
+	case "chaos":
+		chaos(flag.Args()[1:])
+		return
+	}
+
+	work, err := os.MkdirTemp("", "simulation")
+	if err != nil {
+		log.Fatal(err)
+	}
+	binary := serverBinary(work)
+
+	failed := false
+	for _, path := range flag.Args() {
+		sc, err := loadScenario(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dir := filepath.Join(work, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+		ok, err := runScenario(sc, binary, dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			failed = true
+			fmt.Printf("the servers' logs are in %s\n\n", dir)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+	os.RemoveAll(work)
+}
+
+// serverBinary returns -server-bin, or builds the server into work.
+func serverBinary(work string) string {
+	if *serverBin != "" {
+		return *serverBin
+	}
+	log.Println("Building the server...")
+	binary, err := launcher.Build(work)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return binary
+}
+
+// runScenario plays sc against a new cluster in dir and prints the checks.
+// It reports whether all of them held, and returns an error, with the
+// cluster stopped, if it could not play sc at all.
+func runScenario(sc *Scenario, binary, dir string) (bool, error) {
+	fmt.Printf("=== %s\n", sc.Name)
+	cluster := launcher.New(binary, dir, sc.Nodes, *basePort, "-fault-injection")
+	if !*verbose {
+		cluster.Output = io.Discard
+	}
+	// the nodes that did start have to be stopped too
+	defer cluster.StopAll(5 * time.Second)
+	if err := cluster.StartAll(); err != nil {
+		return false, err
+	}
+
+	r, err := newRun(sc, cluster)
+	if err != nil {
+		return false, err
+	}
+	defer r.close()
+
+	checks, err := r.play()
+	if err != nil {
+		fmt.Printf("FAIL  %v\n\n", err)
+		return false, nil
+	}
+	ok := true
+	for _, c := range checks {
+		verdict := "ok  "
+		switch {
+		case c.skipped:
+			verdict = "skip"
+		case !c.ok:
+			verdict, ok = "FAIL", false
+		}
+		fmt.Printf("%s  %s: %s\n", verdict, c.name, c.detail)
+	}
+	fmt.Println()
+
+	if *histories != "" {
+		path := filepath.Join(*histories, filepath.Base(dir)+".jsonl")
+		if err := r.recorder.Save(path); err != nil {
+			log.Printf("Failed to save history: %v", err)
+		}
+	}
+	return ok, nil
+}
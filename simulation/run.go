@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"Replication/frontend"
+	proto "Replication/grpc"
+	"Replication/history"
+	"Replication/launcher"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	startTimeout = 10 * time.Second
+	callTimeout  = 3 * time.Second
+	checkTimeout = 10 * time.Second
+)
+
+// run is one scenario played against a fresh cluster.
+type run struct {
+	sc       *Scenario
+	cluster  *launcher.Cluster
+	recorder *history.Recorder
+	conns    []*grpc.ClientConn
+	servers  []proto.AuctionServerClient
+	faults   []proto.FaultsClient
+
+	mutex     sync.Mutex
+	groups    [][]int // the current partition, nil when healed
+	acked     []ackedBid
+	failed    int
+	frontends map[string]*frontend.Frontend // by bidder and first node
+}
+
+type ackedBid struct {
+	bidder string
+	amount int64
+}
+
+// check is one invariant and whether it held. A skipped check could not be
+// decided.
+type check struct {
+	name    string
+	ok      bool
+	detail  string
+	skipped bool
+}
+
+func newRun(sc *Scenario, cluster *launcher.Cluster) (*run, error) {
+	r := &run{
+		sc:        sc,
+		cluster:   cluster,
+		recorder:  history.NewRecorder(),
+		frontends: make(map[string]*frontend.Frontend),
+	}
+	for _, addr := range cluster.Addrs {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		r.conns = append(r.conns, conn)
+		r.servers = append(r.servers, proto.NewAuctionServerClient(conn))
+		r.faults = append(r.faults, proto.NewFaultsClient(conn))
+	}
+	return r, nil
+}
+
+func (r *run) close() {
+	for _, f := range r.frontends {
+		f.Close()
+	}
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+}
+
+// frontend returns the bidder's frontend that tries node via first.
+func (r *run) frontend(bidder string, via int) (*frontend.Frontend, error) {
+	key := fmt.Sprintf("%s@%d", bidder, via)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if f, ok := r.frontends[key]; ok {
+		return f, nil
+	}
+	addrs := append(slices.Clone(r.cluster.Addrs[via:]), r.cluster.Addrs[:via]...)
+	f, err := frontend.Dial(addrs, "", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	f.Record(r.recorder)
+	r.frontends[key] = f
+	return f, nil
+}
+
+// retry calls try until it succeeds or timeout has passed.
+func retry(timeout time.Duration, try func(ctx context.Context) error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+		err := try(ctx)
+		cancel()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// play runs the scenario and returns the invariants it checked.
+func (r *run) play() ([]check, error) {
+	tokens := make(map[string]string)
+	for _, b := range r.sc.Bidders {
+		f, err := r.frontend(b.Name, 0)
+		if err != nil {
+			return nil, err
+		}
+		err = retry(startTimeout, func(ctx context.Context) error {
+			creds, err := f.Register(ctx, b.Name)
+			if err == nil {
+				tokens[b.Name] = creds.Token
+			}
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("register %s: %w", b.Name, err)
+		}
+	}
+	if r.sc.Auction != "" {
+		err := retry(startTimeout, func(ctx context.Context) error {
+			_, err := r.servers[0].CreateAuction(ctx, &proto.AuctionSpec{Auction: r.sc.Auction})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create %s: %w", r.sc.Auction, err)
+		}
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, b := range r.sc.Bidders {
+		wg.Add(1)
+		go func(b Bidder) {
+			defer wg.Done()
+			for _, bid := range b.schedule() {
+				time.Sleep(time.Until(start.Add(bid.At.Duration)))
+				r.bid(b.Name, tokens[b.Name], bid)
+			}
+		}(b)
+	}
+	events := slices.Clone(r.sc.Events)
+	slices.SortStableFunc(events, func(a, b Event) int { return int(a.At.Duration - b.At.Duration) })
+	for _, e := range events {
+		time.Sleep(time.Until(start.Add(e.At.Duration)))
+		if err := r.apply(e); err != nil {
+			log.Printf("%s at %v: %v", e.Action, e.At, err)
+		}
+	}
+	wg.Wait()
+
+	return r.checks(), nil
+}
+
+func (r *run) bid(bidder, token string, bid Bid) {
+	f, err := r.frontend(bidder, bid.Via)
+	if err != nil {
+		log.Printf("%s cannot bid: %v", bidder, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	ack, err := f.Bid(ctx, &proto.Amount{
+		Amount:    bid.Amount,
+		Bidder:    bidder,
+		Timestamp: int32(time.Now().UnixNano()),
+		Token:     token,
+		Auction:   r.sc.Auction,
+	})
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch {
+	case err != nil:
+		r.failed++
+		log.Printf("%s bids %d: %v", bidder, bid.Amount, err)
+	case ack.Ack == "success":
+		r.acked = append(r.acked, ackedBid{bidder, bid.Amount})
+		fallthrough
+	default:
+		if *verbose {
+			log.Printf("%s bids %d: %s", bidder, bid.Amount, ack.Ack)
+		}
+	}
+}
+
+func (r *run) apply(e Event) error {
+	log.Printf("%v: %s %v", e.At, e.Action, e.nodes())
+	switch e.Action {
+	case "crash":
+		return r.cluster.Kill(e.Node)
+	case "stop":
+		return r.cluster.Stop(e.Node, 5*time.Second)
+	case "restart":
+		if err := r.cluster.Restart(e.Node); err != nil {
+			return err
+		}
+		// the new process has forgotten the partition
+		go r.injectPartition(e.Node, startTimeout)
+		return nil
+	case "partition", "heal":
+		r.mutex.Lock()
+		r.groups = e.Groups
+		r.mutex.Unlock()
+		for i := range r.cluster.Addrs {
+			if r.cluster.Running(i) {
+				if err := r.injectPartition(i, callTimeout); err != nil {
+					log.Printf("%s: %v", r.cluster.Name(i), err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (e Event) nodes() any {
+	switch e.Action {
+	case "partition":
+		return e.Groups
+	case "heal":
+		return ""
+	}
+	return e.Node
+}
+
+// injectPartition makes node i drop its calls to every node on another side
+// of the current partition.
+func (r *run) injectPartition(i int, timeout time.Duration) error {
+	r.mutex.Lock()
+	groups := r.groups
+	r.mutex.Unlock()
+
+	side := func(n int) int {
+		for g, members := range groups {
+			if slices.Contains(members, n) {
+				return g + 1
+			}
+		}
+		return 0
+	}
+	rules := &proto.FaultRules{}
+	if groups != nil {
+		for j, addr := range r.cluster.Addrs {
+			if j != i && (side(i) == 0 || side(i) != side(j)) {
+				rules.Rules = append(rules.Rules, &proto.FaultRule{To: addr, Drop: 1})
+			}
+		}
+	}
+	return retry(timeout, func(ctx context.Context) error {
+		_, err := r.faults[i].SetFaults(ctx, rules)
+		return err
+	})
+}
+
+// checks waits for the replicas to settle and then checks the invariants.
+func (r *run) checks() []check {
+	var checks []check
+
+	var final *proto.Outcome
+	f, _ := r.frontend(r.sc.Bidders[0].Name, 0)
+	err := retry(r.sc.Settle.Duration, func(ctx context.Context) error {
+		var err error
+		final, err = f.Result(ctx, r.sc.Auction)
+		return err
+	})
+	if err != nil {
+		return append(checks, check{name: "the cluster answers", detail: err.Error()})
+	}
+
+	checks = append(checks, r.agreement(final))
+
+	r.mutex.Lock()
+	lost := check{name: "no acknowledged bid is lost", ok: true, detail: fmt.Sprintf("%d acknowledged, %d failed", len(r.acked), r.failed)}
+	for _, b := range r.acked {
+		if b.amount > final.HighestBid || (b.amount == final.HighestBid && b.bidder != final.HighestBidder) {
+			lost.ok = false
+			lost.detail = fmt.Sprintf("%s's bid of %d was acknowledged, but %s wins with %d", b.bidder, b.amount, final.HighestBidder, final.HighestBid)
+		}
+	}
+	r.mutex.Unlock()
+	checks = append(checks, lost)
+
+	ops, err := history.Operations(r.recorder.Events())
+	if err != nil {
+		checks = append(checks, check{name: "the history is linearizable", detail: err.Error()})
+	} else {
+		result := history.CheckTimeout(history.AuctionModel, ops, checkTimeout)
+		c := check{name: "the history is linearizable", ok: result.Linearizable, detail: fmt.Sprintf("%d operations", len(ops))}
+		if len(result.Undecided) > 0 {
+			// too many failed bids to try every order; not a violation
+			c.skipped = true
+			c.detail += fmt.Sprintf(", undecided after %v", checkTimeout)
+		}
+		checks = append(checks, c)
+	}
+
+	if want := r.sc.Expect; want != nil {
+		checks = append(checks, check{
+			name:   "the expected bidder wins",
+			ok:     final.HighestBidder == want.Winner && final.HighestBid == want.HighestBid,
+			detail: fmt.Sprintf("want %s with %d, got %s with %d", want.Winner, want.HighestBid, final.HighestBidder, final.HighestBid),
+		})
+	}
+	return checks
+}
+
+// agreement waits until every running replica has applied the final
+// outcome.
+func (r *run) agreement(final *proto.Outcome) check {
+	c := check{name: "all replicas agree on the winner"}
+	err := retry(r.sc.Settle.Duration, func(ctx context.Context) error {
+		var down []string
+		for i, server := range r.servers {
+			if !r.cluster.Running(i) {
+				down = append(down, r.cluster.Name(i))
+				continue
+			}
+			out, err := server.Result(ctx, &proto.AuctionRef{Auction: r.sc.Auction, Local: true})
+			if err != nil {
+				return fmt.Errorf("%s: %w", r.cluster.Name(i), err)
+			}
+			if out.HighestBidder != final.HighestBidder || out.HighestBid != final.HighestBid {
+				return fmt.Errorf("%s has %s with %d, the leader %s with %d", r.cluster.Name(i), out.HighestBidder, out.HighestBid, final.HighestBidder, final.HighestBid)
+			}
+		}
+		c.detail = fmt.Sprintf("%s with %d", final.HighestBidder, final.HighestBid)
+		if len(down) > 0 {
+			c.detail += fmt.Sprintf(", %v down", down)
+		}
+		if len(down) == len(r.servers) {
+			return errors.New("every replica is down")
+		}
+		return nil
+	})
+	c.ok = err == nil
+	if err != nil {
+		c.detail = err.Error()
+	}
+	return c
+}
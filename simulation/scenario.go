@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Scenario describes one simulation run: who bids what and when, what
+// happens to the replicas meanwhile, and how the auction should end.
+type Scenario struct {
+	Name    string   `json:"name"`
+	Nodes   int      `json:"nodes"`
+	Auction string   `json:"auction"` // the servers' default auction if empty
+	Bidders []Bidder `json:"bidders"`
+	Events  []Event  `json:"events"`
+	// Settle is how long the replicas get to agree after the last bid and
+	// event.
+	Settle Duration `json:"settle"`
+	Expect *Expect  `json:"expect"`
+}
+
+type Bidder struct {
+	Name string `json:"name"`
+	Bids []Bid  `json:"bids"`
+}
+
+// Bid is sent At after the start, and again Times-1 more times Every
+// interval after that, Raise higher each time. Amounts are in minor units of
+// the auction's currency. Via is the replica to send it to first; without it
+// bids go to node 0 first.
+type Bid struct {
+	At     Duration `json:"at"`
+	Amount int64    `json:"amount"`
+	Every  Duration `json:"every"`
+	Times  int      `json:"times"`
+	Raise  int64    `json:"raise"`
+	Via    int      `json:"via"`
+}
+
+// Event happens to the cluster At after the start. Action is one of crash
+// (SIGKILL), stop (SIGTERM), restart, partition and heal. Node is the node
+// for crash, stop and restart, and Groups the sides of a partition; nodes
+// in no group are cut off from all others.
+type Event struct {
+	At     Duration `json:"at"`
+	Action string   `json:"action"`
+	Node   int      `json:"node"`
+	Groups [][]int  `json:"groups"`
+}
+
+// Expect is the outcome the replicas should agree on.
+type Expect struct {
+	Winner     string `json:"winner"`
+	HighestBid int64  `json:"highestBid"`
+}
+
+// Duration reads durations like "1.5s" from JSON.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations are strings like \"1.5s\": %w", err)
+	}
+	var err error
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func loadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc := &Scenario{Nodes: 3, Settle: Duration{5 * time.Second}}
+	if err := json.Unmarshal(data, sc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if sc.Name == "" {
+		sc.Name = path
+	}
+	return sc, sc.validate()
+}
+
+func (sc *Scenario) validate() error {
+	if sc.Nodes < 1 {
+		return fmt.Errorf("%s: needs at least one node", sc.Name)
+	}
+	if len(sc.Bidders) == 0 {
+		return fmt.Errorf("%s: needs at least one bidder", sc.Name)
+	}
+	node := func(i int) error {
+		if i < 0 || i >= sc.Nodes {
+			return fmt.Errorf("%s: there is no node %d", sc.Name, i)
+		}
+		return nil
+	}
+	for _, b := range sc.Bidders {
+		for _, bid := range b.Bids {
+			if err := node(bid.Via); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range sc.Events {
+		switch e.Action {
+		case "crash", "stop", "restart":
+			if err := node(e.Node); err != nil {
+				return err
+			}
+		case "partition":
+			for _, g := range e.Groups {
+				for _, i := range g {
+					if err := node(i); err != nil {
+						return err
+					}
+				}
+			}
+		case "heal":
+		default:
+			return fmt.Errorf("%s: unknown action %q", sc.Name, e.Action)
+		}
+	}
+	return nil
+}
+
+// schedule expands a bidder's repeated bids into single bids, in the order
+// they are sent.
+func (b Bidder) schedule() []Bid {
+	var bids []Bid
+	for _, bid := range b.Bids {
+		times := max(bid.Times, 1)
+		for i := 0; i < times; i++ {
+			bids = append(bids, Bid{
+				At:     Duration{bid.At.Duration + time.Duration(i)*bid.Every.Duration},
+				Amount: bid.Amount + int64(i)*bid.Raise,
+				Via:    bid.Via,
+			})
+		}
+	}
+	sort.SliceStable(bids, func(i, j int) bool { return bids[i].At.Duration < bids[j].At.Duration })
+	return bids
+}
@@ -0,0 +1,61 @@
+// tokengen makes the key the servers sign bearer tokens with, and issues
+// tokens for auctioneers, admins and bidders.
+//
+//	go run . -new-key ../certs/token.key
+//	go run . -key ../certs/token.key -role auctioneer -subject alice
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"Replication/security"
+)
+
+var (
+	newKey   = flag.String("new-key", "", "Write a new random signing key to this file and exit")
+	keyFile  = flag.String("key", "../certs/token.key", "Signing key shared with the servers")
+	role     = flag.String("role", security.RoleAuctioneer, "Role of the token: bidder, auctioneer, admin or replica")
+	subject  = flag.String("subject", "", "Who the token is for, the bidder name for bidders")
+	validFor = flag.Duration("valid", 24*time.Hour, "How long the token is valid, 0 for forever")
+)
+
+func main() {
+	flag.Parse()
+
+	if *newKey != "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("Failed to generate key: %v", err)
+		}
+		if err := os.WriteFile(*newKey, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+			log.Fatalf("Failed to write key: %v", err)
+		}
+		log.Printf("Signing key written to %s", *newKey)
+		return
+	}
+
+	switch *role {
+	case security.RoleBidder, security.RoleAuctioneer, security.RoleAdmin, security.RoleReplica:
+	default:
+		log.Fatalf("Unknown role %q", *role)
+	}
+	if *subject == "" {
+		log.Fatal("-subject is required")
+	}
+
+	signer, err := security.LoadSigner(*keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	token, err := signer.Issue(*subject, *role, *validFor)
+	if err != nil {
+		log.Fatalf("Failed to issue token: %v", err)
+	}
+	fmt.Println(token)
+}
@@ -0,0 +1,114 @@
+// Package tracing sets up OpenTelemetry tracing for the servers and clients.
+// A trace starts at the client and follows a call through the gRPC calls it
+// makes, so a bid shows up as one trace across every replica it touched.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// Config is where a process sends its spans.
+type Config struct {
+	Exporter string // "" for no tracing, "stdout" or "otlp"
+	Endpoint string // OTLP gRPC endpoint, e.g. localhost:4317
+	Service  string // service.name of the spans
+	Instance string // service.instance.id of the spans, e.g. the replica's address
+
+	// SkipRoots are prefixes of span names that are only traced as part of
+	// a trace that is already going, such as the replicas' heartbeats.
+	SkipRoots []string
+}
+
+// Setup installs the tracer provider and the W3C trace context propagator.
+// The returned function flushes the spans that are left and stops.
+func (c Config) Setup() (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch c.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithInsecure()}
+		if c.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(c.Endpoint))
+		}
+		exporter, err = otlptracegrpc.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", c.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := []resource.Option{resource.WithAttributes(semconv.ServiceName(c.Service))}
+	if c.Instance != "" {
+		attrs = append(attrs, resource.WithAttributes(semconv.ServiceInstanceID(c.Instance)))
+	}
+	res, err := resource.New(context.Background(), attrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(skipRoots{c.SkipRoots})),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// skipRoots samples every root span but those whose names start with one of
+// the prefixes.
+type skipRoots struct {
+	prefixes []string
+}
+
+func (s skipRoots) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(p.Name, prefix) {
+			return sdktrace.SamplingResult{
+				Decision:   sdktrace.Drop,
+				Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+			}
+		}
+	}
+	return sdktrace.AlwaysSample().ShouldSample(p)
+}
+
+func (s skipRoots) Description() string {
+	return fmt.Sprintf("SkipRoots%v", s.prefixes)
+}
+
+// ServerOption traces the calls a gRPC server receives.
+func ServerOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler())
+}
+
+// DialOption traces the calls made over a connection and passes the trace
+// context along to the other side.
+func DialOption() grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler())
+}
+
+// Tracer returns the tracer named name.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}